@@ -0,0 +1,254 @@
+package resource
+
+import (
+	"fmt"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	authConfigMapNamespace = "kube-system"
+	authConfigMapName      = "aws-auth"
+	// authMapAttempts bounds how often the aws-auth config map is read and
+	// written again when someone else changes it at the same time.
+	authMapAttempts = 3
+)
+
+// authMappingsConfigured reports whether the model maps any IAM identities
+// into the cluster.
+func authMappingsConfigured(model *Model) bool {
+	return model != nil && (len(model.MapRoles) > 0 || len(model.MapUsers) > 0 || len(model.MapAccounts) > 0)
+}
+
+// reconcileAuthMappings brings the entries the resource owns in the
+// aws-auth config map in line with the model. Entries for roles, users and
+// accounts that are not in the model or the previous model belong to
+// someone else, such as EKS itself for node group roles, and are left as
+// they are.
+func reconcileAuthMappings(svc eksiface.EKSAPI, prevModel *Model, model *Model, connect func(*Model) (kubernetesAPI, error)) handler.ProgressEvent {
+	if !authMappingsConfigured(prevModel) && !authMappingsConfigured(model) {
+		return successEvent(model)
+	}
+	if model.Endpoint == nil || model.CertificateAuthorityData == nil {
+		if progress := describeCluster(svc, model); progress.OperationStatus != handler.Success {
+			return progress
+		}
+	}
+	kube, err := connect(model)
+	if err != nil {
+		return errorEvent(model, err)
+	}
+	for attempt := 1; ; attempt++ {
+		err = updateAuthConfigMap(kube, prevModel, model)
+		if err == nil || !kubernetesConflict(err) || attempt == authMapAttempts {
+			break
+		}
+	}
+	if err != nil {
+		return errorEvent(model, err)
+	}
+	return successEvent(model)
+}
+
+// updateAuthConfigMap reads the aws-auth config map, creating it if it does
+// not exist, merges the model's entries into it and writes it back if
+// anything changed.
+func updateAuthConfigMap(kube kubernetesAPI, prevModel *Model, model *Model) error {
+	authMap, err := kube.GetConfigMap(authConfigMapNamespace, authConfigMapName)
+	create := false
+	if err != nil {
+		if !kubernetesNotFound(err) {
+			return err
+		}
+		authMap = newConfigMap(authConfigMapNamespace, authConfigMapName)
+		create = true
+	}
+	if authMap.Data == nil {
+		authMap.Data = map[string]string{}
+	}
+	changed := false
+	for _, section := range authSections {
+		sectionChanged, err := mergeAuthSection(authMap.Data, section, section.entries(prevModel), section.entries(model))
+		if err != nil {
+			return err
+		}
+		changed = changed || sectionChanged
+	}
+	if !changed {
+		return nil
+	}
+	if create {
+		return kube.CreateConfigMap(authMap)
+	}
+	return kube.UpdateConfigMap(authMap)
+}
+
+func kubernetesConflict(err error) bool {
+	herr, ok := err.(*handlerError)
+	return ok && herr.code == cloudformation.HandlerErrorCodeResourceConflict
+}
+
+// authSection is one of the lists in the aws-auth config map. Entries are
+// identified by their ARN, or are plain account IDs when key is empty.
+type authSection struct {
+	name    string
+	key     string
+	entries func(model *Model) []interface{}
+}
+
+var authSections = []authSection{
+	{name: "mapRoles", key: "rolearn", entries: roleMappingEntries},
+	{name: "mapUsers", key: "userarn", entries: userMappingEntries},
+	{name: "mapAccounts", entries: accountEntries},
+}
+
+func roleMappingEntries(model *Model) []interface{} {
+	entries := []interface{}{}
+	if model == nil {
+		return entries
+	}
+	for _, mapping := range model.MapRoles {
+		entries = append(entries, authEntry("rolearn", mapping.RoleArn, mapping.Username, mapping.Groups))
+	}
+	return entries
+}
+
+func userMappingEntries(model *Model) []interface{} {
+	entries := []interface{}{}
+	if model == nil {
+		return entries
+	}
+	for _, mapping := range model.MapUsers {
+		entries = append(entries, authEntry("userarn", mapping.UserArn, mapping.Username, mapping.Groups))
+	}
+	return entries
+}
+
+func accountEntries(model *Model) []interface{} {
+	entries := []interface{}{}
+	if model == nil {
+		return entries
+	}
+	for _, account := range model.MapAccounts {
+		entries = append(entries, account)
+	}
+	return entries
+}
+
+func authEntry(key string, arn *string, username *string, groups []string) yaml.MapSlice {
+	entry := yaml.MapSlice{{Key: key, Value: aws.StringValue(arn)}}
+	if username != nil {
+		entry = append(entry, yaml.MapItem{Key: "username", Value: *username})
+	}
+	if len(groups) > 0 {
+		entry = append(entry, yaml.MapItem{Key: "groups", Value: groups})
+	}
+	return entry
+}
+
+// mergeAuthSection merges the desired entries of one section into the
+// config map data. Existing entries with the same identity are replaced in
+// place, entries that were in previous but are no longer desired are
+// removed, and all other entries are kept unchanged. It reports whether the
+// section changed.
+func mergeAuthSection(data map[string]string, section authSection, previous []interface{}, desired []interface{}) (bool, error) {
+	existing, err := section.decode(data[section.name])
+	if err != nil {
+		return false, fmt.Errorf("%s/%s %s is not valid: %v", authConfigMapNamespace, authConfigMapName, section.name, err)
+	}
+	wanted := map[string]interface{}{}
+	for _, entry := range desired {
+		wanted[section.identity(entry)] = entry
+	}
+	owned := map[string]bool{}
+	for _, entry := range previous {
+		owned[section.identity(entry)] = true
+	}
+	merged := []interface{}{}
+	placed := map[string]bool{}
+	for _, entry := range existing {
+		id := section.identity(entry)
+		if replacement, ok := wanted[id]; ok {
+			if !placed[id] {
+				merged = append(merged, replacement)
+				placed[id] = true
+			}
+			continue
+		}
+		if !owned[id] {
+			merged = append(merged, entry)
+		}
+	}
+	for _, entry := range desired {
+		if id := section.identity(entry); !placed[id] {
+			merged = append(merged, entry)
+			placed[id] = true
+		}
+	}
+	rendered := ""
+	if len(merged) > 0 {
+		content, err := yaml.Marshal(merged)
+		if err != nil {
+			return false, err
+		}
+		rendered = string(content)
+	}
+	if sameYAML(rendered, data[section.name]) {
+		return false, nil
+	}
+	if rendered == "" {
+		delete(data, section.name)
+	} else {
+		data[section.name] = rendered
+	}
+	return true, nil
+}
+
+// decode reads the entries of the section from the config map. Entries
+// keep the order of their keys so that those written by others are written
+// back as they were.
+func (s authSection) decode(content string) ([]interface{}, error) {
+	entries := []interface{}{}
+	if s.key == "" {
+		err := yaml.Unmarshal([]byte(content), &entries)
+		return entries, err
+	}
+	mappings := []yaml.MapSlice{}
+	if err := yaml.Unmarshal([]byte(content), &mappings); err != nil {
+		return nil, err
+	}
+	for _, mapping := range mappings {
+		entries = append(entries, mapping)
+	}
+	return entries, nil
+}
+
+// identity returns the ARN or account ID an entry of the section is for.
+func (s authSection) identity(entry interface{}) string {
+	if s.key == "" {
+		return fmt.Sprint(entry)
+	}
+	if mapping, ok := entry.(yaml.MapSlice); ok {
+		for _, item := range mapping {
+			if item.Key == s.key {
+				return fmt.Sprint(item.Value)
+			}
+		}
+	}
+	return ""
+}
+
+// sameYAML reports whether two YAML documents hold the same values, so that
+// a section written by someone else in another style is not rewritten.
+func sameYAML(a string, b string) bool {
+	var left, right interface{}
+	if yaml.Unmarshal([]byte(a), &left) != nil || yaml.Unmarshal([]byte(b), &right) != nil {
+		return false
+	}
+	leftContent, _ := yaml.Marshal(left)
+	rightContent, _ := yaml.Marshal(right)
+	return string(leftContent) == string(rightContent)
+}
@@ -0,0 +1,186 @@
+package resource
+
+import (
+	"errors"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const nodeRoleEntry = `- rolearn: arn:aws:iam::111122223333:role/node
+  username: system:node:{{EC2PrivateDNSName}}
+  groups:
+  - system:bootstrappers
+  - system:nodes
+`
+
+type mockKubernetesClient struct {
+	MockConfigMap  *configMap
+	MockConflicts  int
+	CreatedMap     *configMap
+	UpdatedMap     *configMap
+	UpdateAttempts int
+	MockApplyError error
+	Applied        []string
+	Deleted        []string
+}
+
+func (m *mockKubernetesClient) GetConfigMap(namespace string, name string) (*configMap, error) {
+	if m.MockConfigMap == nil {
+		return nil, kubernetesError("GET", configMapPath(namespace, name), 404, nil)
+	}
+	data := map[string]string{}
+	for key, value := range m.MockConfigMap.Data {
+		data[key] = value
+	}
+	current := *m.MockConfigMap
+	current.Data = data
+	return &current, nil
+}
+
+func (m *mockKubernetesClient) CreateConfigMap(configMap *configMap) error {
+	m.CreatedMap = configMap
+	return nil
+}
+
+func (m *mockKubernetesClient) UpdateConfigMap(configMap *configMap) error {
+	m.UpdateAttempts++
+	if m.UpdateAttempts <= m.MockConflicts {
+		return kubernetesError("PUT", configMapPath(configMap.Metadata.Namespace, configMap.Metadata.Name), 409, nil)
+	}
+	m.UpdatedMap = configMap
+	return nil
+}
+
+func (m *mockKubernetesClient) ApplyObject(object *manifestObject) error {
+	if m.MockApplyError != nil {
+		return m.MockApplyError
+	}
+	m.Applied = append(m.Applied, object.key())
+	return nil
+}
+
+func (m *mockKubernetesClient) DeleteObject(object *manifestObject) error {
+	m.Deleted = append(m.Deleted, object.key())
+	return nil
+}
+
+func connectTo(kube kubernetesAPI) func(*Model) (kubernetesAPI, error) {
+	return func(*Model) (kubernetesAPI, error) {
+		return kube, nil
+	}
+}
+
+func makeAuthModel() *Model {
+	model := makeModel()
+	model.Endpoint = aws.String("https://endpoint")
+	model.CertificateAuthorityData = aws.String("ca")
+	model.MapRoles = []RoleMapping{{
+		RoleArn:  aws.String("arn:aws:iam::111122223333:role/ci"),
+		Username: aws.String("ci"),
+		Groups:   []string{"system:masters"},
+	}}
+	return model
+}
+
+func makeAuthConfigMap(data map[string]string) *configMap {
+	authMap := newConfigMap(authConfigMapNamespace, authConfigMapName)
+	authMap.Metadata.ResourceVersion = "1"
+	authMap.Data = data
+	return authMap
+}
+
+func TestReconcileAuthMappings(t *testing.T) {
+	t.Run("not configured", func(t *testing.T) {
+		progress := reconcileAuthMappings(&mockEKSClient{}, nil, makeModel(), func(*Model) (kubernetesAPI, error) {
+			return nil, errors.New("should not connect")
+		})
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+	})
+	t.Run("creates the config map", func(t *testing.T) {
+		kube := &mockKubernetesClient{}
+		progress := reconcileAuthMappings(&mockEKSClient{}, nil, makeAuthModel(), connectTo(kube))
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+		assert.Equal(t, "aws-auth", kube.CreatedMap.Metadata.Name)
+		assert.Equal(t, "- rolearn: arn:aws:iam::111122223333:role/ci\n  username: ci\n  groups:\n  - system:masters\n", kube.CreatedMap.Data["mapRoles"])
+		assert.NotContains(t, kube.CreatedMap.Data, "mapUsers")
+	})
+	t.Run("keeps entries added by others", func(t *testing.T) {
+		kube := &mockKubernetesClient{MockConfigMap: makeAuthConfigMap(map[string]string{"mapRoles": nodeRoleEntry})}
+		model := makeAuthModel()
+		model.MapAccounts = []string{"444455556666"}
+		progress := reconcileAuthMappings(&mockEKSClient{}, nil, model, connectTo(kube))
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+		assert.Equal(t, nodeRoleEntry+"- rolearn: arn:aws:iam::111122223333:role/ci\n  username: ci\n  groups:\n  - system:masters\n", kube.UpdatedMap.Data["mapRoles"])
+		assert.Equal(t, "- \"444455556666\"\n", kube.UpdatedMap.Data["mapAccounts"])
+		assert.Equal(t, "1", kube.UpdatedMap.Metadata.ResourceVersion)
+	})
+	t.Run("replaces and removes owned entries", func(t *testing.T) {
+		prevModel := makeAuthModel()
+		prevModel.MapUsers = []UserMapping{{UserArn: aws.String("arn:aws:iam::111122223333:user/admin"), Username: aws.String("admin")}}
+		kube := &mockKubernetesClient{MockConfigMap: makeAuthConfigMap(map[string]string{
+			"mapRoles": "- rolearn: arn:aws:iam::111122223333:role/ci\n  username: ci\n" + nodeRoleEntry,
+			"mapUsers": "- userarn: arn:aws:iam::111122223333:user/admin\n  username: admin\n",
+		})}
+		model := makeAuthModel()
+		model.MapRoles[0].Groups = []string{"deployers"}
+		progress := reconcileAuthMappings(&mockEKSClient{}, prevModel, model, connectTo(kube))
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+		assert.Equal(t, "- rolearn: arn:aws:iam::111122223333:role/ci\n  username: ci\n  groups:\n  - deployers\n"+nodeRoleEntry, kube.UpdatedMap.Data["mapRoles"])
+		assert.NotContains(t, kube.UpdatedMap.Data, "mapUsers")
+	})
+	t.Run("unchanged", func(t *testing.T) {
+		kube := &mockKubernetesClient{MockConfigMap: makeAuthConfigMap(map[string]string{
+			"mapRoles": "- groups: [system:masters]\n  rolearn: arn:aws:iam::111122223333:role/ci\n  username: ci\n",
+		})}
+		progress := reconcileAuthMappings(&mockEKSClient{}, makeAuthModel(), makeAuthModel(), connectTo(kube))
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+		assert.Nil(t, kube.UpdatedMap)
+	})
+	t.Run("retries conflicts", func(t *testing.T) {
+		kube := &mockKubernetesClient{MockConfigMap: makeAuthConfigMap(nil), MockConflicts: 2}
+		progress := reconcileAuthMappings(&mockEKSClient{}, nil, makeAuthModel(), connectTo(kube))
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+		assert.Equal(t, 3, kube.UpdateAttempts)
+
+		kube = &mockKubernetesClient{MockConfigMap: makeAuthConfigMap(nil), MockConflicts: authMapAttempts}
+		progress = reconcileAuthMappings(&mockEKSClient{}, nil, makeAuthModel(), connectTo(kube))
+		assert.Equal(t, cloudformation.HandlerErrorCodeResourceConflict, progress.HandlerErrorCode)
+	})
+	t.Run("invalid config map", func(t *testing.T) {
+		kube := &mockKubernetesClient{MockConfigMap: makeAuthConfigMap(map[string]string{"mapRoles": "rolearn: not a list"})}
+		progress := reconcileAuthMappings(&mockEKSClient{}, nil, makeAuthModel(), connectTo(kube))
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
+		assert.Contains(t, progress.Message, "kube-system/aws-auth mapRoles is not valid")
+	})
+	t.Run("describes the cluster for its endpoint", func(t *testing.T) {
+		model := makeAuthModel()
+		model.Endpoint = nil
+		mockSvc := &mockEKSClient{MockCluster: makeCluster()}
+		var connected *Model
+		progress := reconcileAuthMappings(mockSvc, nil, model, func(model *Model) (kubernetesAPI, error) {
+			connected = model
+			return &mockKubernetesClient{}, nil
+		})
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+		assert.Equal(t, *mockSvc.MockCluster.Endpoint, *connected.Endpoint)
+	})
+}
+
+func TestValidateAuthMappings(t *testing.T) {
+	model := makeAuthModel()
+	model.MapUsers = []UserMapping{{UserArn: aws.String("arn:aws:iam::111122223333:user/admin"), Username: aws.String("admin")}}
+	model.MapAccounts = []string{"444455556666"}
+	assert.Empty(t, validateModel(model))
+	model.MapRoles = append(model.MapRoles, model.MapRoles[0], RoleMapping{Username: aws.String("nobody")})
+	model.MapUsers = append(model.MapUsers, UserMapping{UserArn: aws.String("arn:aws:iam::111122223333:user/other")})
+	model.MapAccounts = append(model.MapAccounts, "444455556666", "1234")
+	assert.Len(t, validateModel(model), 5)
+
+	model = makeAuthModel()
+	model.ResourcesVpcConfig.EndpointPublicAccess = aws.Bool(false)
+	model.ResourcesVpcConfig.EndpointPrivateAccess = aws.Bool(true)
+	assert.Equal(t, []string{kubernetesEndpointProblem("MapRoles, MapUsers and MapAccounts")}, validateModel(model))
+}
@@ -0,0 +1,192 @@
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// callbackStateVersion is the current shape of callbackState. Contexts
+// without a version predate it and are migrated when they are read.
+const callbackStateVersion = 1
+
+// The phases of a long running operation recorded in the callback context.
+const (
+	// phaseCreating creates the cluster in ClusterName and, once OpComplete
+	// is set, waits for it to become ACTIVE.
+	phaseCreating = "Creating"
+	// phaseUpdating has cluster update steps still to start.
+	phaseUpdating = "Updating"
+	// phaseWaitingUpdate waits on the EKS update in UpdateId.
+	phaseWaitingUpdate = "WaitingUpdate"
+	// phaseUpgradingNodeGroups waits on node groups being upgraded to the
+	// version of VersionHop before the next hop of a version update.
+	phaseUpgradingNodeGroups = "UpgradingNodeGroups"
+	// phaseNodeGroups waits on node groups being created, updated or deleted.
+	phaseNodeGroups = "NodeGroups"
+	// phaseFargateProfiles waits on a Fargate profile being created or deleted.
+	phaseFargateProfiles = "FargateProfiles"
+	// phaseManifests has manifest objects still to apply or delete.
+	phaseManifests = "Manifests"
+	// phaseDeleting waits for the cluster to be deleted.
+	phaseDeleting = "Deleting"
+)
+
+var phases = []string{phaseCreating, phaseUpdating, phaseWaitingUpdate, phaseUpgradingNodeGroups, phaseNodeGroups, phaseFargateProfiles, phaseManifests, phaseDeleting}
+
+// callbackState is the state carried between invocations of a handler in
+// the callback context.
+type callbackState struct {
+	Version          int
+	Phase            string
+	ClusterName      *string
+	OpComplete       bool
+	StartedAt        string            `json:",omitempty"`
+	PhaseStartedAt   string            `json:",omitempty"`
+	PendingUpdates   []string          `json:",omitempty"`
+	UpdateID         string            `json:"UpdateId,omitempty"`
+	VersionPlan      []string          `json:",omitempty"`
+	VersionHop       int               `json:",omitempty"`
+	NodeGroups       map[string]string `json:",omitempty"`
+	NodeGroupUpdates map[string]string `json:",omitempty"`
+	FargateProfile   string            `json:",omitempty"`
+	ManifestObjects  []string          `json:",omitempty"`
+	// ClientRequestToken is sent with CreateCluster, so a cluster found
+	// under ClusterName can be told apart from one created by someone else.
+	ClientRequestToken string `json:",omitempty"`
+}
+
+// callbackStateFromContext reads the state from a callback context, which
+// holds plain JSON values once it has been round tripped by the plugin.
+// Contexts written before the state was versioned are migrated, taking the
+// phase from the keys that are present or, failing that, from legacyPhase.
+// A nil context means the operation is starting and gives a nil state.
+func callbackStateFromContext(callbackContext map[string]interface{}, legacyPhase string) (*callbackState, error) {
+	if callbackContext == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(callbackContext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid callback context: %v", err)
+	}
+	state := &callbackState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid callback context: %v", err)
+	}
+	if state.Version > callbackStateVersion {
+		return nil, fmt.Errorf("unsupported callback context version %d", state.Version)
+	}
+	if state.Version == 0 {
+		state.migrate(legacyPhase)
+	}
+	if err := state.validate(); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// migrate brings an unversioned context up to the current version.
+func (s *callbackState) migrate(legacyPhase string) {
+	switch {
+	case s.UpdateID != "":
+		s.Phase = phaseWaitingUpdate
+	case len(s.PendingUpdates) > 0:
+		s.Phase = phaseUpdating
+	case s.NodeGroups != nil:
+		s.Phase = phaseNodeGroups
+	case s.FargateProfile != "":
+		s.Phase = phaseFargateProfiles
+	default:
+		s.Phase = legacyPhase
+	}
+	s.Version = callbackStateVersion
+}
+
+func (s *callbackState) validate() error {
+	if !containsString(phases, s.Phase) {
+		return fmt.Errorf("invalid callback context: unknown phase %q", s.Phase)
+	}
+	if s.Phase == phaseWaitingUpdate && s.UpdateID == "" {
+		return fmt.Errorf("invalid callback context: phase %s has no UpdateId", s.Phase)
+	}
+	if s.Phase == phaseUpgradingNodeGroups && len(s.VersionPlan) == 0 {
+		return fmt.Errorf("invalid callback context: phase %s has no VersionPlan", s.Phase)
+	}
+	if s.VersionHop < 0 || (len(s.VersionPlan) > 0 && s.VersionHop >= len(s.VersionPlan)) {
+		return fmt.Errorf("invalid callback context: VersionHop %d is outside the version plan", s.VersionHop)
+	}
+	return nil
+}
+
+// restoreClusterName names the model after the cluster the operation is
+// working on when the model does not name one itself, so that a cluster
+// whose name was generated on an earlier invocation is found again.
+func (s *callbackState) restoreClusterName(model *Model) {
+	if s != nil && model.Name == nil && s.ClusterName != nil {
+		model.Name = s.ClusterName
+	}
+}
+
+// context renders the state as a callback context. Empty optional fields
+// are left out.
+func (s *callbackState) context() map[string]interface{} {
+	if s == nil {
+		return nil
+	}
+	callbackContext := map[string]interface{}{
+		"Version":     s.Version,
+		"Phase":       s.Phase,
+		"ClusterName": s.ClusterName,
+		"OpComplete":  s.OpComplete,
+	}
+	optional := map[string]interface{}{
+		"StartedAt":          s.StartedAt,
+		"PhaseStartedAt":     s.PhaseStartedAt,
+		"UpdateId":           s.UpdateID,
+		"FargateProfile":     s.FargateProfile,
+		"ClientRequestToken": s.ClientRequestToken,
+	}
+	for key, value := range optional {
+		if value != "" {
+			callbackContext[key] = value
+		}
+	}
+	if s.PendingUpdates != nil {
+		callbackContext["PendingUpdates"] = s.PendingUpdates
+	}
+	if s.VersionPlan != nil {
+		callbackContext["VersionPlan"] = s.VersionPlan
+		callbackContext["VersionHop"] = s.VersionHop
+	}
+	if s.NodeGroups != nil {
+		callbackContext["NodeGroups"] = s.NodeGroups
+	}
+	if s.NodeGroupUpdates != nil {
+		callbackContext["NodeGroupUpdates"] = s.NodeGroupUpdates
+	}
+	if s.ManifestObjects != nil {
+		callbackContext["ManifestObjects"] = s.ManifestObjects
+	}
+	return callbackContext
+}
+
+// stampCallbackContext records when the operation and its current phase
+// started in an in-progress event's callback context, carrying the times
+// over from the previous state while they still apply.
+func stampCallbackContext(callbackContext map[string]interface{}, prev *callbackState, now time.Time) {
+	if callbackContext == nil {
+		return
+	}
+	started := now.UTC().Format(time.RFC3339)
+	phaseStarted := started
+	if prev != nil {
+		if prev.StartedAt != "" {
+			started = prev.StartedAt
+		}
+		if prev.Phase == callbackContext["Phase"] && prev.PhaseStartedAt != "" {
+			phaseStarted = prev.PhaseStartedAt
+		}
+	}
+	callbackContext["StartedAt"] = started
+	callbackContext["PhaseStartedAt"] = phaseStarted
+}
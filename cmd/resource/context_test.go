@@ -0,0 +1,130 @@
+package resource
+
+import (
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// stateOf reads the callback state from an in-progress event.
+func stateOf(t *testing.T, progress handler.ProgressEvent) *callbackState {
+	state, err := callbackStateFromContext(progress.CallbackContext, "")
+	assert.Nil(t, err)
+	return state
+}
+
+func TestCallbackStateFromContext(t *testing.T) {
+	t.Run("nil", func(t *testing.T) {
+		state, err := callbackStateFromContext(nil, phaseCreating)
+		assert.Nil(t, err)
+		assert.Nil(t, state)
+	})
+	t.Run("round trip", func(t *testing.T) {
+		original := &callbackState{
+			Version:            callbackStateVersion,
+			Phase:              phaseWaitingUpdate,
+			ClusterName:        aws.String("test"),
+			OpComplete:         true,
+			UpdateID:           "Id",
+			PendingUpdates:     []string{updateStepVersion, updateStepTags},
+			VersionPlan:        []string{"1.15", "1.16"},
+			VersionHop:         1,
+			ManifestObjects:    []string{"Namespace/default/team-a"},
+			ClientRequestToken: "token",
+		}
+		state, err := callbackStateFromContext(original.context(), phaseUpdating)
+		assert.Nil(t, err)
+		assert.Equal(t, original, state)
+	})
+	t.Run("json values", func(t *testing.T) {
+		state, err := callbackStateFromContext(map[string]interface{}{
+			"Version":          float64(1),
+			"Phase":            phaseNodeGroups,
+			"ClusterName":      "test",
+			"OpComplete":       true,
+			"NodeGroups":       map[string]interface{}{"workers": "CREATING"},
+			"NodeGroupUpdates": map[string]interface{}{},
+		}, phaseCreating)
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"workers": "CREATING"}, state.NodeGroups)
+	})
+	t.Run("legacy contexts", func(t *testing.T) {
+		cases := []struct {
+			Context  map[string]interface{}
+			Expected string
+		}{
+			{map[string]interface{}{"ClusterName": "test", "OpComplete": true}, phaseDeleting},
+			{map[string]interface{}{"UpdateId": "Id", "PendingUpdates": []interface{}{updateStepConfig}}, phaseWaitingUpdate},
+			{map[string]interface{}{"PendingUpdates": []interface{}{updateStepConfig}}, phaseUpdating},
+			{map[string]interface{}{"NodeGroups": map[string]interface{}{}}, phaseNodeGroups},
+			{map[string]interface{}{"FargateProfile": "one"}, phaseFargateProfiles},
+		}
+		for _, tc := range cases {
+			state, err := callbackStateFromContext(tc.Context, phaseDeleting)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.Expected, state.Phase)
+			assert.Equal(t, callbackStateVersion, state.Version)
+		}
+	})
+	t.Run("malformed", func(t *testing.T) {
+		invalid := []map[string]interface{}{
+			{"ClusterName": "test", "OpComplete": "yes"},
+			{"Version": float64(callbackStateVersion + 1), "Phase": phaseCreating},
+			{"Version": float64(1), "Phase": "Sleeping"},
+			{"Version": float64(1), "Phase": phaseWaitingUpdate},
+			{"Version": float64(1), "Phase": phaseWaitingUpdate, "UpdateId": "Id", "VersionPlan": []interface{}{"1.15"}, "VersionHop": float64(1)},
+		}
+		for _, callbackContext := range invalid {
+			_, err := callbackStateFromContext(callbackContext, phaseCreating)
+			assert.NotNil(t, err)
+		}
+	})
+}
+
+func TestCallbackStateContext(t *testing.T) {
+	var state *callbackState
+	assert.Nil(t, state.context())
+	callbackContext := (&callbackState{Version: 1, Phase: phaseUpdating, PendingUpdates: []string{updateStepTags}}).context()
+	assert.Equal(t, []string{updateStepTags}, callbackContext["PendingUpdates"])
+	assert.NotContains(t, callbackContext, "UpdateId")
+	assert.NotContains(t, callbackContext, "VersionHop")
+}
+
+func TestRestoreClusterName(t *testing.T) {
+	model := &Model{}
+	var state *callbackState
+	state.restoreClusterName(model)
+	assert.Nil(t, model.Name)
+
+	state, err := callbackStateFromContext(map[string]interface{}{
+		"Version":     float64(callbackStateVersion),
+		"Phase":       phaseCreating,
+		"ClusterName": "EKS-ABCDEFGH",
+	}, "")
+	assert.Nil(t, err)
+	state.restoreClusterName(model)
+	assert.Equal(t, aws.String("EKS-ABCDEFGH"), model.Name)
+
+	model.Name = aws.String("named")
+	state.restoreClusterName(model)
+	assert.Equal(t, aws.String("named"), model.Name)
+}
+
+func TestStampCallbackContext(t *testing.T) {
+	now := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	callbackContext := map[string]interface{}{"Phase": phaseWaitingUpdate}
+	stampCallbackContext(callbackContext, nil, now)
+	assert.Equal(t, "2020-03-01T12:00:00Z", callbackContext["StartedAt"])
+	assert.Equal(t, "2020-03-01T12:00:00Z", callbackContext["PhaseStartedAt"])
+
+	prev := &callbackState{Phase: phaseUpdating, StartedAt: "2020-03-01T11:00:00Z", PhaseStartedAt: "2020-03-01T11:30:00Z"}
+	stampCallbackContext(callbackContext, prev, now)
+	assert.Equal(t, "2020-03-01T11:00:00Z", callbackContext["StartedAt"])
+	assert.Equal(t, "2020-03-01T12:00:00Z", callbackContext["PhaseStartedAt"])
+
+	prev.Phase = phaseWaitingUpdate
+	stampCallbackContext(callbackContext, prev, now)
+	assert.Equal(t, "2020-03-01T11:30:00Z", callbackContext["PhaseStartedAt"])
+}
@@ -0,0 +1,153 @@
+package resource
+
+import (
+	"fmt"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	"strings"
+)
+
+const (
+	// deletionPolicyFail refuses to delete a cluster that still has node
+	// groups or Fargate profiles that are not in the model.
+	deletionPolicyFail = "Fail"
+	// deletionPolicyCascade deletes every node group and Fargate profile in
+	// the cluster before deleting the cluster.
+	deletionPolicyCascade = "Cascade"
+)
+
+// dependents lists the node groups and Fargate profiles in a cluster. Both
+// must be deleted before EKS will delete the cluster.
+type dependents struct {
+	NodeGroups      []string
+	FargateProfiles []string
+}
+
+func (d dependents) empty() bool {
+	return len(d.NodeGroups) == 0 && len(d.FargateProfiles) == 0
+}
+
+func (d dependents) String() string {
+	parts := []string{}
+	if len(d.NodeGroups) > 0 {
+		parts = append(parts, "node groups "+strings.Join(d.NodeGroups, ", "))
+	}
+	if len(d.FargateProfiles) > 0 {
+		parts = append(parts, "Fargate profiles "+strings.Join(d.FargateProfiles, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// listDependents enumerates the cluster's node groups and Fargate profiles.
+// A cluster that no longer exists has none.
+func listDependents(svc eksiface.EKSAPI, clusterName *string) (dependents, error) {
+	found := dependents{}
+	err := svc.ListNodegroupsPages(&eks.ListNodegroupsInput{ClusterName: clusterName},
+		func(page *eks.ListNodegroupsOutput, _ bool) bool {
+			found.NodeGroups = append(found.NodeGroups, aws.StringValueSlice(page.Nodegroups)...)
+			return true
+		})
+	if err != nil {
+		if resourceNotFound(err) {
+			return dependents{}, nil
+		}
+		return dependents{}, err
+	}
+	err = svc.ListFargateProfilesPages(&eks.ListFargateProfilesInput{ClusterName: clusterName},
+		func(page *eks.ListFargateProfilesOutput, _ bool) bool {
+			found.FargateProfiles = append(found.FargateProfiles, aws.StringValueSlice(page.FargateProfileNames)...)
+			return true
+		})
+	if err != nil {
+		if resourceNotFound(err) {
+			return dependents{}, nil
+		}
+		return dependents{}, err
+	}
+	return found, nil
+}
+
+// deleteDependents removes the cluster's node groups and Fargate profiles so
+// the cluster itself can be deleted. With the Cascade policy every dependent
+// in the cluster is deleted; otherwise only those in the model are, and the
+// delete fails before anything is deleted if any others exist, naming them.
+func deleteDependents(svc eksiface.EKSAPI, model *Model) handler.ProgressEvent {
+	nodeGroups := nodeGroupNames(model)
+	fargateProfiles := fargateProfileNames(model)
+	if aws.StringValue(model.DependencyDeletionPolicy) == deletionPolicyCascade {
+		found, err := listDependents(svc, model.Name)
+		if err != nil {
+			return errorEvent(model, err)
+		}
+		nodeGroups = appendMissing(nodeGroups, found.NodeGroups)
+		fargateProfiles = appendMissing(fargateProfiles, found.FargateProfiles)
+	} else if progress := checkDependents(svc, model); progress.OperationStatus != handler.Success {
+		return progress
+	}
+	if progress := deleteNodeGroups(svc, model, nodeGroups); progress.OperationStatus != handler.Success {
+		return progress
+	}
+	if progress := deleteFargateProfiles(svc, model, fargateProfiles); progress.OperationStatus != handler.Success {
+		return progress
+	}
+	found, err := listDependents(svc, model.Name)
+	if err != nil {
+		return errorEvent(model, err)
+	}
+	if !found.empty() {
+		return dependentsConflictEvent(model, found)
+	}
+	return successEvent(model)
+}
+
+// checkDependents fails the delete if, unless the policy is Cascade, the
+// cluster has node groups or Fargate profiles that are not in the model and
+// so would block the cluster's deletion.
+func checkDependents(svc eksiface.EKSAPI, model *Model) handler.ProgressEvent {
+	if aws.StringValue(model.DependencyDeletionPolicy) == deletionPolicyCascade {
+		return successEvent(model)
+	}
+	found, err := listDependents(svc, model.Name)
+	if err != nil {
+		return errorEvent(model, err)
+	}
+	unmanaged := dependents{
+		NodeGroups:      missingStrings(found.NodeGroups, nodeGroupNames(model)),
+		FargateProfiles: missingStrings(found.FargateProfiles, fargateProfileNames(model)),
+	}
+	if !unmanaged.empty() {
+		return dependentsConflictEvent(model, unmanaged)
+	}
+	return successEvent(model)
+}
+
+func dependentsConflictEvent(model *Model, found dependents) handler.ProgressEvent {
+	return errorEvent(model, &handlerError{
+		code: cloudformation.HandlerErrorCodeResourceConflict,
+		message: fmt.Sprintf("cluster deletion is blocked by %s, which are not managed by this resource; "+
+			"delete them or set DependencyDeletionPolicy to Cascade", found),
+	})
+}
+
+// missingStrings returns the values that are not in known.
+func missingStrings(values []string, known []string) []string {
+	missing := []string{}
+	for _, v := range values {
+		if !containsString(known, v) {
+			missing = append(missing, v)
+		}
+	}
+	return missing
+}
+
+func appendMissing(values []string, more []string) []string {
+	for _, v := range more {
+		if !containsString(values, v) {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,104 @@
+package resource
+
+import (
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"testing"
+)
+
+// mockDependentsClient serves node groups from the embedded node group mock
+// and Fargate profiles from the Fargate mock, and lists both.
+type mockDependentsClient struct {
+	mockNodeGroupClient
+	Fargate *mockFargateClient
+}
+
+func (m *mockDependentsClient) DescribeFargateProfile(input *eks.DescribeFargateProfileInput) (*eks.DescribeFargateProfileOutput, error) {
+	return m.Fargate.DescribeFargateProfile(input)
+}
+
+func (m *mockDependentsClient) DeleteFargateProfile(input *eks.DeleteFargateProfileInput) (*eks.DeleteFargateProfileOutput, error) {
+	return m.Fargate.DeleteFargateProfile(input)
+}
+
+func (m *mockDependentsClient) ListNodegroupsPages(_ *eks.ListNodegroupsInput, fn func(*eks.ListNodegroupsOutput, bool) bool) error {
+	names := []string{}
+	for name := range m.MockNodeGroups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fn(&eks.ListNodegroupsOutput{Nodegroups: aws.StringSlice(names)}, true)
+	return nil
+}
+
+func (m *mockDependentsClient) ListFargateProfilesPages(_ *eks.ListFargateProfilesInput, fn func(*eks.ListFargateProfilesOutput, bool) bool) error {
+	names := []string{}
+	for name := range m.Fargate.MockProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fn(&eks.ListFargateProfilesOutput{FargateProfileNames: aws.StringSlice(names)}, true)
+	return nil
+}
+
+func makeDependentsClient() *mockDependentsClient {
+	return &mockDependentsClient{
+		mockNodeGroupClient: mockNodeGroupClient{MockNodeGroups: map[string]*eks.Nodegroup{
+			"managed":   makeNodegroup("managed"),
+			"unmanaged": makeNodegroup("unmanaged"),
+		}},
+		Fargate: &mockFargateClient{MockProfiles: map[string]*eks.FargateProfile{
+			"external": makeEksFargateProfile("external"),
+		}},
+	}
+}
+
+func TestDeleteDependents(t *testing.T) {
+	t.Run("fail", func(t *testing.T) {
+		mockSvc := makeDependentsClient()
+		model := makeModel()
+		model.NodeGroups = []NodeGroup{makeNodeGroup("managed")}
+		progress := deleteDependents(mockSvc, model)
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
+		assert.Equal(t, cloudformation.HandlerErrorCodeResourceConflict, progress.HandlerErrorCode)
+		assert.Contains(t, progress.Message, "node groups unmanaged; Fargate profiles external")
+		assert.Empty(t, mockSvc.Deleted)
+	})
+	t.Run("fail managed only", func(t *testing.T) {
+		mockSvc := makeDependentsClient()
+		delete(mockSvc.MockNodeGroups, "unmanaged")
+		mockSvc.Fargate.MockProfiles = map[string]*eks.FargateProfile{}
+		model := makeModel()
+		model.NodeGroups = []NodeGroup{makeNodeGroup("managed")}
+		progress := deleteDependents(mockSvc, model)
+		assert.Equal(t, handler.InProgress, progress.OperationStatus)
+		assert.Equal(t, []string{"managed"}, mockSvc.Deleted)
+		delete(mockSvc.MockNodeGroups, "managed")
+		progress = deleteDependents(mockSvc, model)
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+	})
+	t.Run("cascade", func(t *testing.T) {
+		mockSvc := makeDependentsClient()
+		model := makeModel()
+		model.DependencyDeletionPolicy = aws.String(deletionPolicyCascade)
+		progress := deleteDependents(mockSvc, model)
+		assert.Equal(t, handler.InProgress, progress.OperationStatus)
+		assert.Equal(t, []string{"managed", "unmanaged"}, mockSvc.Deleted)
+		mockSvc.MockNodeGroups = map[string]*eks.Nodegroup{}
+		progress = deleteDependents(mockSvc, model)
+		assert.Equal(t, "Fargate profile external DELETING", progress.Message)
+		mockSvc.Fargate.MockProfiles = map[string]*eks.FargateProfile{}
+		progress = deleteDependents(mockSvc, model)
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+	})
+}
+
+func TestDependentsString(t *testing.T) {
+	assert.True(t, dependents{}.empty())
+	assert.Equal(t, "node groups a, b", dependents{NodeGroups: []string{"a", "b"}}.String())
+	assert.Equal(t, "Fargate profiles c", dependents{FargateProfiles: []string{"c"}}.String())
+}
@@ -0,0 +1,147 @@
+package resource
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"sort"
+)
+
+// Update steps, in the order they are applied to the cluster.
+const (
+	updateStepConfig  = "Config"
+	updateStepLogging = "Logging"
+	updateStepVersion = "Version"
+	updateStepTags    = "Tags"
+)
+
+// pendingUpdates compares the previous and desired models and returns the
+// update steps needed to bring the cluster in line with the desired model.
+func pendingUpdates(prevModel *Model, model *Model) []string {
+	pending := []string{}
+	if vpcConfigChanged(prevModel, model) {
+		pending = append(pending, updateStepConfig)
+	}
+	if !stringSetsEqual(enabledLogTypes(prevModel), enabledLogTypes(model)) {
+		pending = append(pending, updateStepLogging)
+	}
+	if versionChanged(prevModel, model.Version) {
+		pending = append(pending, updateStepVersion)
+	}
+	if tags, removed := tagChanges(prevModel, model); len(tags) > 0 || len(removed) > 0 {
+		pending = append(pending, updateStepTags)
+	}
+	return pending
+}
+
+// defaultPublicAccessCidrs is what EKS allows to reach the public endpoint
+// when PublicAccessCidrs is not set.
+var defaultPublicAccessCidrs = []string{"0.0.0.0/0"}
+
+// endpointAccess is the endpoint access of a VPC configuration, with the
+// settings it leaves out replaced by the EKS defaults.
+type endpointAccess struct {
+	Public      bool
+	Private     bool
+	PublicCidrs []string
+}
+
+func endpointAccessOf(vpcConfig *ResourcesVpcConfig) endpointAccess {
+	access := endpointAccess{Public: true, PublicCidrs: defaultPublicAccessCidrs}
+	if vpcConfig == nil {
+		return access
+	}
+	if vpcConfig.EndpointPublicAccess != nil {
+		access.Public = *vpcConfig.EndpointPublicAccess
+	}
+	access.Private = aws.BoolValue(vpcConfig.EndpointPrivateAccess)
+	if len(vpcConfig.PublicAccessCidrs) > 0 {
+		access.PublicCidrs = vpcConfig.PublicAccessCidrs
+	}
+	return access
+}
+
+// vpcConfigChanged reports whether the cluster's endpoint access changed,
+// counting a setting that is left out as its default. The subnets and
+// security groups are create-only, so a change to them replaces the cluster
+// rather than updating it.
+func vpcConfigChanged(prevModel *Model, model *Model) bool {
+	var prevConfig *ResourcesVpcConfig
+	if prevModel != nil {
+		prevConfig = prevModel.ResourcesVpcConfig
+	}
+	prev, desired := endpointAccessOf(prevConfig), endpointAccessOf(model.ResourcesVpcConfig)
+	return prev.Public != desired.Public ||
+		prev.Private != desired.Private ||
+		(desired.Public && !stringSetsEqual(prev.PublicCidrs, desired.PublicCidrs))
+}
+
+func enabledLogTypes(model *Model) []string {
+	if model == nil || model.Logging == nil {
+		return nil
+	}
+	return model.Logging.EnabledTypes
+}
+
+// tagChanges returns the tags that have to be added or changed on the cluster,
+// and the keys of tags that were removed from the model.
+func tagChanges(prevModel *Model, model *Model) (map[string]*string, []string) {
+	prevTags := map[string]*string{}
+	if prevModel != nil {
+		prevTags = tagsToMap(prevModel.Tags)
+	}
+	tags := tagsToMap(model.Tags)
+	changed := map[string]*string{}
+	for k, v := range tags {
+		if prev, ok := prevTags[k]; !ok || aws.StringValue(prev) != aws.StringValue(v) {
+			changed[k] = v
+		}
+	}
+	removed := []string{}
+	for k := range prevTags {
+		if _, ok := tags[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+	sort.Strings(removed)
+	return changed, removed
+}
+
+func versionChanged(prevModel *Model, version *string) bool {
+	if prevModel == nil || version == nil {
+		return false
+	}
+	return aws.StringValue(prevModel.Version) != *version
+}
+
+// stringSetsEqual reports whether a and b hold the same values, ignoring order.
+func stringSetsEqual(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := map[string]int{}
+	for _, v := range a {
+		counts[v]++
+	}
+	for _, v := range b {
+		if counts[v] == 0 {
+			return false
+		}
+		counts[v]--
+	}
+	return true
+}
+
+func boolsEqual(a *bool, b *bool) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
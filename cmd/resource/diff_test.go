@@ -0,0 +1,90 @@
+package resource
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPendingUpdates(t *testing.T) {
+	t.Run("nothing changed", func(t *testing.T) {
+		assert.Empty(t, pendingUpdates(makeModel(), makeModel()))
+	})
+	t.Run("subnet order ignored", func(t *testing.T) {
+		prevModel := makeModel()
+		prevModel.ResourcesVpcConfig.SubnetIds = []string{"subnet-1", "subnet-2"}
+		model := makeModel()
+		model.ResourcesVpcConfig.SubnetIds = []string{"subnet-2", "subnet-1"}
+		assert.Empty(t, pendingUpdates(prevModel, model))
+	})
+	t.Run("subnets and security groups are create-only", func(t *testing.T) {
+		model := makeModel()
+		model.ResourcesVpcConfig.SubnetIds = []string{"subnet-2"}
+		model.ResourcesVpcConfig.SecurityGroupIds = []string{"sg-2"}
+		assert.Empty(t, pendingUpdates(makeModel(), model))
+	})
+	t.Run("config and version changed", func(t *testing.T) {
+		model := makeModel()
+		model.ResourcesVpcConfig.PublicAccessCidrs = []string{"10.0.0.0/8"}
+		model.Version = aws.String("1.15")
+		assert.Equal(t, []string{updateStepConfig, updateStepVersion}, pendingUpdates(makeModel(), model))
+	})
+	t.Run("endpoint access changed", func(t *testing.T) {
+		model := makeModel()
+		model.ResourcesVpcConfig.EndpointPrivateAccess = aws.Bool(true)
+		assert.Equal(t, []string{updateStepConfig}, pendingUpdates(makeModel(), model))
+	})
+	t.Run("unset endpoint access is the default", func(t *testing.T) {
+		model := makeModel()
+		model.ResourcesVpcConfig.EndpointPublicAccess = aws.Bool(true)
+		model.ResourcesVpcConfig.EndpointPrivateAccess = aws.Bool(false)
+		model.ResourcesVpcConfig.PublicAccessCidrs = []string{"0.0.0.0/0"}
+		assert.Empty(t, pendingUpdates(makeModel(), model))
+		assert.Empty(t, pendingUpdates(model, makeModel()))
+	})
+	t.Run("endpoint access reset to the default", func(t *testing.T) {
+		prevModel := makeModel()
+		prevModel.ResourcesVpcConfig.PublicAccessCidrs = []string{"10.0.0.0/8"}
+		assert.Equal(t, []string{updateStepConfig}, pendingUpdates(prevModel, makeModel()))
+	})
+	t.Run("logging changed", func(t *testing.T) {
+		prevModel := makeModel()
+		prevModel.Logging = &Logging{EnabledTypes: []string{"api", "audit"}}
+		model := makeModel()
+		model.Logging = &Logging{EnabledTypes: []string{"audit"}}
+		assert.Equal(t, []string{updateStepLogging}, pendingUpdates(prevModel, model))
+	})
+	t.Run("tags changed", func(t *testing.T) {
+		model := makeModel()
+		model.Tags = []Tag{{Key: aws.String("team"), Value: aws.String("platform")}}
+		assert.Equal(t, []string{updateStepTags}, pendingUpdates(makeModel(), model))
+	})
+	t.Run("version changed", func(t *testing.T) {
+		model := makeModel()
+		model.Version = aws.String("1.15")
+		assert.Equal(t, []string{updateStepVersion}, pendingUpdates(makeModel(), model))
+	})
+}
+
+func TestStringSetsEqual(t *testing.T) {
+	assert.True(t, stringSetsEqual(nil, []string{}))
+	assert.True(t, stringSetsEqual([]string{"a", "b"}, []string{"b", "a"}))
+	assert.False(t, stringSetsEqual([]string{"a", "a"}, []string{"a", "b"}))
+	assert.False(t, stringSetsEqual([]string{"a"}, []string{"a", "b"}))
+}
+
+func TestTagChanges(t *testing.T) {
+	prevModel := &Model{Tags: []Tag{
+		{Key: aws.String("unchanged"), Value: aws.String("a")},
+		{Key: aws.String("changed"), Value: aws.String("b")},
+		{Key: aws.String("removed"), Value: aws.String("c")},
+	}}
+	model := &Model{Tags: []Tag{
+		{Key: aws.String("unchanged"), Value: aws.String("a")},
+		{Key: aws.String("changed"), Value: aws.String("B")},
+		{Key: aws.String("added"), Value: aws.String("d")},
+	}}
+	tags, removed := tagChanges(prevModel, model)
+	assert.Equal(t, map[string]string{"changed": "B", "added": "d"}, aws.StringValueMap(tags))
+	assert.Equal(t, []string{"removed"}, removed)
+}
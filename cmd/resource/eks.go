@@ -1,21 +1,38 @@
 package resource
 
 import (
+	cryptorand "crypto/rand"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/eks"
 	"github.com/aws/aws-sdk-go/service/eks/eksiface"
 	"math/rand"
+	"sort"
+	"strings"
 	"time"
 )
 
 const (
 	generatedClusterNameSuffixLength = 8
 	generatedClusterNamePrefix       = "EKS-"
+	// clientRequestTokenBytes is the number of random bytes in a client
+	// request token, which is sent hex encoded.
+	clientRequestTokenBytes = 16
 )
 
+var logTypes = []string{
+	eks.LogTypeApi,
+	eks.LogTypeAudit,
+	eks.LogTypeAuthenticator,
+	eks.LogTypeControllerManager,
+	eks.LogTypeScheduler,
+}
+
 func stabilize(svc eksiface.EKSAPI, model *Model, desiredState string, opComplete bool) handler.ProgressEvent {
 	input := &eks.DescribeClusterInput{Name: model.Name}
 	response, err := svc.DescribeCluster(input)
@@ -32,29 +49,98 @@ func stabilize(svc eksiface.EKSAPI, model *Model, desiredState string, opComplet
 	if *response.Cluster.Status == "FAILED" {
 		return errorEvent(model, errors.New("cluster status is FAILED"))
 	}
-	return inProgressEvent(model, "cluster "+*response.Cluster.Status, opComplete)
+	phase := phaseCreating
+	if desiredState == "DELETED" {
+		phase = phaseDeleting
+	}
+	return inProgressEvent(model, "cluster "+*response.Cluster.Status, &callbackState{Phase: phase, OpComplete: opComplete})
 }
 
-func createCluster(svc eksiface.EKSAPI, model *Model, callbackContext map[string]interface{}) handler.ProgressEvent {
-	if callbackContext != nil {
+// createCluster creates the cluster in two steps. The first invocation only
+// picks the cluster's name and records it in the callback context, so that
+// a CreateCluster call that fails after taking effect, or an invocation cut
+// short during it, is picked up again by name instead of creating a second
+// cluster.
+func createCluster(svc eksiface.EKSAPI, model *Model, state *callbackState) handler.ProgressEvent {
+	if state == nil {
+		if problems := validateModel(model); len(problems) > 0 {
+			return invalidRequestEvent(model, strings.Join(problems, "; "))
+		}
+		token, err := newClientRequestToken()
+		if err != nil {
+			return errorEvent(model, err)
+		}
+		model.Name = generateClusterName(model.Name)
+		return inProgressEvent(model, "Creating cluster "+*model.Name, &callbackState{Phase: phaseCreating, ClientRequestToken: token})
+	}
+	if state.Phase != phaseCreating || state.OpComplete {
 		return stabilize(svc, model, "ACTIVE", true)
 	}
-	model.Name = generateClusterName(model.Name)
+	response, err := svc.DescribeCluster(&eks.DescribeClusterInput{Name: model.Name})
+	if err == nil {
+		return resumeCreate(svc, model, state, response.Cluster)
+	}
+	if !resourceNotFound(err) {
+		return errorEvent(model, err)
+	}
 	input := &eks.CreateClusterInput{
-		Name: model.Name,
-		ResourcesVpcConfig: &eks.VpcConfigRequest{
-			SecurityGroupIds: aws.StringSlice(model.ResourcesVpcConfig.SecurityGroupIds),
-			SubnetIds:        aws.StringSlice(model.ResourcesVpcConfig.SubnetIds),
-		},
-		RoleArn: model.RoleArn,
-		Version: model.Version,
-	}
-	response, err := svc.CreateCluster(input)
+		Name:               model.Name,
+		ResourcesVpcConfig: vpcConfigRequest(model.ResourcesVpcConfig),
+		RoleArn:            model.RoleArn,
+		Version:            model.Version,
+		Logging:            clusterLogging(model.Logging),
+		Tags:               tagsToMap(model.Tags),
+	}
+	if state.ClientRequestToken != "" {
+		input.ClientRequestToken = aws.String(state.ClientRequestToken)
+	}
+	created, err := svc.CreateCluster(input)
 	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == eks.ErrCodeResourceInUseException {
+			response, describeErr := svc.DescribeCluster(&eks.DescribeClusterInput{Name: model.Name})
+			if describeErr == nil {
+				return resumeCreate(svc, model, state, response.Cluster)
+			}
+		}
 		return errorEvent(model, err)
 	}
-	describeClusterToModel(*response.Cluster, model)
-	return inProgressEvent(model, "Cluster creation initiated", true)
+	describeClusterToModel(*created.Cluster, model)
+	return inProgressEvent(model, "Cluster creation initiated", &callbackState{Phase: phaseCreating, OpComplete: true})
+}
+
+// resumeCreate handles a create that finds a cluster under its name. A
+// cluster created by an earlier invocation of this operation is stabilized;
+// any other cluster already holds the name.
+func resumeCreate(svc eksiface.EKSAPI, model *Model, state *callbackState, cluster *eks.Cluster) handler.ProgressEvent {
+	if !createdByOperation(cluster, state) {
+		return errorEvent(model, &handlerError{
+			code:    cloudformation.HandlerErrorCodeAlreadyExists,
+			message: fmt.Sprintf("cluster %s already exists", *model.Name),
+		})
+	}
+	return stabilize(svc, model, "ACTIVE", true)
+}
+
+// createdByOperation reports whether the cluster was created by an earlier
+// invocation of this operation rather than by someone else. The client
+// request token decides when the operation has one; contexts written
+// before tokens were recorded fall back to the creation time.
+func createdByOperation(cluster *eks.Cluster, state *callbackState) bool {
+	if state.ClientRequestToken != "" {
+		return aws.StringValue(cluster.ClientRequestToken) == state.ClientRequestToken
+	}
+	return createdSince(cluster, state.StartedAt)
+}
+
+// createdSince reports whether the cluster was created after the operation
+// started. A cluster is assumed to be the operation's own if either time is
+// unknown.
+func createdSince(cluster *eks.Cluster, startedAt string) bool {
+	started, err := time.Parse(time.RFC3339, startedAt)
+	if err != nil || cluster.CreatedAt == nil {
+		return true
+	}
+	return !cluster.CreatedAt.Before(started)
 }
 
 func describeCluster(svc eksiface.EKSAPI, model *Model) handler.ProgressEvent {
@@ -67,38 +153,193 @@ func describeCluster(svc eksiface.EKSAPI, model *Model) handler.ProgressEvent {
 	return successEvent(model)
 }
 
-func updateCluster(svc eksiface.EKSAPI, model *Model, callbackContext map[string]interface{}) handler.ProgressEvent {
-	if callbackContext != nil {
-		opComplete := callbackContext["OpComplete"].(bool)
-		progress := stabilize(svc, model, "ACTIVE", opComplete)
-		if progress.OperationStatus == handler.Success && opComplete == true {
-			return progress
+func updateCluster(svc eksiface.EKSAPI, prevModel *Model, model *Model, state *callbackState) handler.ProgressEvent {
+	if state == nil {
+		if problems := validateModel(model); len(problems) > 0 {
+			return invalidRequestEvent(model, strings.Join(problems, "; "))
+		}
+		return startNextUpdate(svc, prevModel, model, pendingUpdates(prevModel, model))
+	}
+	switch state.Phase {
+	case phaseWaitingUpdate:
+		return stabilizeUpdate(svc, prevModel, model, state)
+	case phaseUpdating:
+		return startNextUpdate(svc, prevModel, model, state.PendingUpdates)
+	case phaseUpgradingNodeGroups:
+		return upgradeNodeGroupsForHop(svc, prevModel, model, state.PendingUpdates, state.VersionPlan, state.VersionHop, state.NodeGroupUpdates)
+	}
+	return startNextUpdate(svc, prevModel, model, nil)
+}
+
+// startNextUpdate issues the EKS call for the first of the pending update
+// steps. EKS only permits one in-flight update per cluster, so the remaining
+// steps are carried in the callback context until it has completed.
+func startNextUpdate(svc eksiface.EKSAPI, prevModel *Model, model *Model, pending []string) handler.ProgressEvent {
+	if len(pending) == 0 {
+		return describeCluster(svc, model)
+	}
+	switch pending[0] {
+	case updateStepConfig:
+		return updateClusterConfig(svc, model, pending)
+	case updateStepLogging:
+		return updateClusterLogging(svc, model, pending)
+	case updateStepVersion:
+		return startVersionUpdate(svc, prevModel, model, pending)
+	case updateStepTags:
+		return updateClusterTags(svc, prevModel, model, pending)
+	}
+	return startNextUpdate(svc, prevModel, model, pending[1:])
+}
+
+func updateClusterConfig(svc eksiface.EKSAPI, model *Model, pending []string) handler.ProgressEvent {
+	input := &eks.UpdateClusterConfigInput{
+		Name:               model.Name,
+		ResourcesVpcConfig: endpointAccessRequest(model.ResourcesVpcConfig),
+	}
+	response, err := svc.UpdateClusterConfig(input)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			if aerr.Code() == eks.ErrCodeResourceInUseException {
+				return pendingUpdateEvent(model, aerr.Error(), pending)
+			}
 		}
+		return errorEvent(model, err)
 	}
+	return updateInProgressEvent(model, "Cluster config update initiated", *response.Update.Id, pending)
+}
+
+func updateClusterLogging(svc eksiface.EKSAPI, model *Model, pending []string) handler.ProgressEvent {
 	input := &eks.UpdateClusterConfigInput{
-		Name: model.Name,
-		ResourcesVpcConfig: &eks.VpcConfigRequest{
-			SecurityGroupIds: aws.StringSlice(model.ResourcesVpcConfig.SecurityGroupIds),
-			SubnetIds:        aws.StringSlice(model.ResourcesVpcConfig.SubnetIds),
-		},
+		Name:    model.Name,
+		Logging: clusterLogging(model.Logging),
+	}
+	response, err := svc.UpdateClusterConfig(input)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			if aerr.Code() == eks.ErrCodeResourceInUseException {
+				return pendingUpdateEvent(model, aerr.Error(), pending)
+			}
+		}
+		return errorEvent(model, err)
+	}
+	return updateInProgressEvent(model, "Cluster logging update initiated", *response.Update.Id, pending)
+}
+
+// updateClusterTags applies tag changes between the previous and desired
+// models. Tagging does not produce an EKS update, so the next pending update
+// is started as soon as the tags have been applied.
+func updateClusterTags(svc eksiface.EKSAPI, prevModel *Model, model *Model, pending []string) handler.ProgressEvent {
+	arn := model.Arn
+	if arn == nil {
+		response, err := svc.DescribeCluster(&eks.DescribeClusterInput{Name: model.Name})
+		if err != nil {
+			return errorEvent(model, err)
+		}
+		arn = response.Cluster.Arn
+	}
+	tags, removed := tagChanges(prevModel, model)
+	if len(removed) > 0 {
+		_, err := svc.UntagResource(&eks.UntagResourceInput{ResourceArn: arn, TagKeys: aws.StringSlice(removed)})
+		if err != nil {
+			return errorEvent(model, err)
+		}
+	}
+	if len(tags) > 0 {
+		_, err := svc.TagResource(&eks.TagResourceInput{ResourceArn: arn, Tags: tags})
+		if err != nil {
+			return errorEvent(model, err)
+		}
+	}
+	return startNextUpdate(svc, prevModel, model, pending[1:])
+}
+
+func startVersionUpdate(svc eksiface.EKSAPI, prevModel *Model, model *Model, pending []string) handler.ProgressEvent {
+	response, err := svc.DescribeCluster(&eks.DescribeClusterInput{Name: model.Name})
+	if err != nil {
+		return errorEvent(model, err)
 	}
-	_, err := svc.UpdateClusterConfig(input)
+	plan, err := versionUpgradePlan(aws.StringValue(response.Cluster.Version), aws.StringValue(model.Version))
+	if err != nil {
+		return invalidRequestEvent(model, err.Error())
+	}
+	if len(plan) == 0 {
+		return startNextUpdate(svc, prevModel, model, pending[1:])
+	}
+	return updateClusterVersion(svc, model, pending, plan, 0)
+}
+
+func updateClusterVersion(svc eksiface.EKSAPI, model *Model, pending []string, plan []string, hop int) handler.ProgressEvent {
+	input := &eks.UpdateClusterVersionInput{
+		Name:    model.Name,
+		Version: aws.String(plan[hop]),
+	}
+	response, err := svc.UpdateClusterVersion(input)
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok {
 			if aerr.Code() == eks.ErrCodeResourceInUseException {
-				return inProgressEvent(model, aerr.Error(), false)
+				return pendingUpdateEvent(model, aerr.Error(), pending)
 			}
 		}
 		return errorEvent(model, err)
 	}
-	return inProgressEvent(model, "Cluster update initiated", true)
+	message := fmt.Sprintf("Cluster version update to %s initiated (step %d of %d)", plan[hop], hop+1, len(plan))
+	return versionUpdateInProgressEvent(model, message, *response.Update.Id, pending, plan, hop)
+}
+
+// upgradeNodeGroupsForHop brings the node groups up to the version of the
+// hop that has just completed before the next hop is started, as EKS does
+// not upgrade the control plane past node groups that are a minor version
+// behind it.
+func upgradeNodeGroupsForHop(svc eksiface.EKSAPI, prevModel *Model, model *Model, pending []string, plan []string, hop int, updates map[string]string) handler.ProgressEvent {
+	names := append(nodeGroupNames(model), removedNodeGroups(prevModel, model)...)
+	statuses, updates, err := upgradeNodeGroups(svc, model, names, plan[hop], updates)
+	if err != nil {
+		return errorEvent(model, err)
+	}
+	if len(statuses) == 0 {
+		return updateClusterVersion(svc, model, pending, plan, hop+1)
+	}
+	message := fmt.Sprintf("upgrading node groups to %s before step %d of %d", plan[hop], hop+2, len(plan))
+	return nodeGroupUpgradeInProgressEvent(model, message, pending, plan, hop, statuses, updates)
+}
+
+func stabilizeUpdate(svc eksiface.EKSAPI, prevModel *Model, model *Model, state *callbackState) handler.ProgressEvent {
+	updateID := state.UpdateID
+	pending := state.PendingUpdates
+	plan := state.VersionPlan
+	hop := state.VersionHop
+	input := &eks.DescribeUpdateInput{
+		Name:     model.Name,
+		UpdateId: aws.String(updateID),
+	}
+	response, err := svc.DescribeUpdate(input)
+	if err != nil {
+		return errorEvent(model, err)
+	}
+	status := aws.StringValue(response.Update.Status)
+	switch status {
+	case eks.UpdateStatusSuccessful:
+		if hop+1 < len(plan) {
+			return upgradeNodeGroupsForHop(svc, prevModel, model, pending, plan, hop, map[string]string{})
+		}
+		if len(pending) > 0 {
+			pending = pending[1:]
+		}
+		return startNextUpdate(svc, prevModel, model, pending)
+	case eks.UpdateStatusFailed, eks.UpdateStatusCancelled:
+		return updateFailedEvent(model, response.Update)
+	}
+	if hop < len(plan) {
+		message := fmt.Sprintf("cluster update to %s %s (step %d of %d)", plan[hop], status, hop+1, len(plan))
+		return versionUpdateInProgressEvent(model, message, updateID, pending, plan, hop)
+	}
+	return updateInProgressEvent(model, "cluster update "+status, updateID, pending)
 }
 
-func deleteCluster(svc eksiface.EKSAPI, model *Model, callbackContext map[string]interface{}) handler.ProgressEvent {
-	if callbackContext != nil {
-		opComplete := callbackContext["OpComplete"].(bool)
-		progress := stabilize(svc, model, "DELETED", opComplete)
-		if progress.OperationStatus == handler.Success && opComplete == true {
+func deleteCluster(svc eksiface.EKSAPI, model *Model, state *callbackState) handler.ProgressEvent {
+	if state != nil {
+		progress := stabilize(svc, model, "DELETED", state.OpComplete)
+		if progress.OperationStatus == handler.Success && state.OpComplete {
 			return progress
 		}
 	}
@@ -109,34 +350,68 @@ func deleteCluster(svc eksiface.EKSAPI, model *Model, callbackContext map[string
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok {
 			if aerr.Code() == eks.ErrCodeResourceInUseException {
-				return inProgressEvent(model, aerr.Error(), false)
+				if found, err := listDependents(svc, model.Name); err == nil && !found.empty() {
+					return inProgressEvent(model, "cluster deletion is waiting on "+found.String(), &callbackState{Phase: phaseDeleting})
+				}
+				return inProgressEvent(model, aerr.Error(), &callbackState{Phase: phaseDeleting})
 			}
 		}
 		return errorEvent(model, err)
 	}
-	return inProgressEvent(model, "Cluster deletion initiated", true)
+	return inProgressEvent(model, "Cluster deletion initiated", &callbackState{Phase: phaseDeleting, OpComplete: true})
 }
 
-func listClusters(svc eksiface.EKSAPI) handler.ProgressEvent {
-	response, err := svc.ListClusters(&eks.ListClustersInput{})
+// listClusters returns the primary identifiers of one page of clusters,
+// along with the token for the next page. Models are not hydrated with
+// DescribeCluster: the plugin gives the List handler no way to receive a
+// caller's options, so hydration could not be opted into and would cost a
+// call per cluster on every list.
+func listClusters(svc eksiface.EKSAPI, nextToken *string) handler.ProgressEvent {
+	response, err := svc.ListClusters(&eks.ListClustersInput{NextToken: nextToken})
 	if err != nil {
 		return errorEvent(nil, err)
 	}
-	models := make([]interface{}, 1)
-	for _, m := range response.Clusters {
-		model := &Model{Name: m}
-		p := describeCluster(svc, model)
-		if p.OperationStatus == handler.Failed {
-			return p
-		}
-		models = append(models, model)
+	models := make([]*Model, len(response.Clusters))
+	for i, name := range response.Clusters {
+		models[i] = &Model{Name: name}
+	}
+	resourceModels := make([]interface{}, 0, len(models))
+	for _, model := range models {
+		resourceModels = append(resourceModels, model)
 	}
 	return handler.ProgressEvent{
-		ResourceModels:  models,
+		ResourceModels:  resourceModels,
+		NextToken:       aws.StringValue(response.NextToken),
 		OperationStatus: handler.Success,
 	}
 }
 
+// listAllClusters follows every page of clusters. The plugin does not pass
+// the caller's next token through to the handler, so the List handler can
+// only return complete results.
+func listAllClusters(svc eksiface.EKSAPI) handler.ProgressEvent {
+	progress := listClusters(svc, nil)
+	for progress.OperationStatus == handler.Success && progress.NextToken != "" {
+		next := listClusters(svc, aws.String(progress.NextToken))
+		if next.OperationStatus != handler.Success {
+			return next
+		}
+		progress.ResourceModels = append(progress.ResourceModels, next.ResourceModels...)
+		progress.NextToken = next.NextToken
+	}
+	return progress
+}
+
+// newClientRequestToken returns a random token identifying one create
+// operation to EKS.
+func newClientRequestToken() (string, error) {
+	b := make([]byte, clientRequestTokenBytes)
+	if _, err := cryptorand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
 func generateClusterName(name *string) *string {
 	if name != nil {
 		if *name != "" {
@@ -153,18 +428,137 @@ func generateClusterName(name *string) *string {
 	return &generated
 }
 
+func vpcConfigRequest(vpcConfig *ResourcesVpcConfig) *eks.VpcConfigRequest {
+	if vpcConfig == nil {
+		return nil
+	}
+	request := &eks.VpcConfigRequest{
+		SecurityGroupIds:      aws.StringSlice(vpcConfig.SecurityGroupIds),
+		SubnetIds:             aws.StringSlice(vpcConfig.SubnetIds),
+		EndpointPublicAccess:  vpcConfig.EndpointPublicAccess,
+		EndpointPrivateAccess: vpcConfig.EndpointPrivateAccess,
+	}
+	if len(vpcConfig.PublicAccessCidrs) > 0 {
+		request.PublicAccessCidrs = aws.StringSlice(vpcConfig.PublicAccessCidrs)
+	}
+	return request
+}
+
+// endpointAccessRequest returns the part of the VPC configuration that can
+// be updated in place. EKS rejects an update that names the subnets or
+// security groups. Settings left out of the model are sent as their
+// defaults, since EKS keeps the current value of a setting that is not
+// sent.
+func endpointAccessRequest(vpcConfig *ResourcesVpcConfig) *eks.VpcConfigRequest {
+	access := endpointAccessOf(vpcConfig)
+	request := &eks.VpcConfigRequest{
+		EndpointPublicAccess:  aws.Bool(access.Public),
+		EndpointPrivateAccess: aws.Bool(access.Private),
+	}
+	if access.Public {
+		request.PublicAccessCidrs = aws.StringSlice(access.PublicCidrs)
+	}
+	return request
+}
+
+func tagsToMap(tags []Tag) map[string]*string {
+	if len(tags) == 0 {
+		return nil
+	}
+	m := map[string]*string{}
+	for _, tag := range tags {
+		m[aws.StringValue(tag.Key)] = aws.String(aws.StringValue(tag.Value))
+	}
+	return m
+}
+
+func mapToTags(m map[string]*string) []Tag {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	tags := make([]Tag, 0, len(keys))
+	for _, k := range keys {
+		tags = append(tags, Tag{Key: aws.String(k), Value: aws.String(aws.StringValue(m[k]))})
+	}
+	return tags
+}
+
+// clusterLogging explicitly disables every log type that is not enabled, so
+// that log types removed from the model are turned off on update.
+func clusterLogging(logging *Logging) *eks.Logging {
+	enabled := []string{}
+	if logging != nil {
+		enabled = logging.EnabledTypes
+	}
+	disabled := []string{}
+	for _, logType := range logTypes {
+		if !containsString(enabled, logType) {
+			disabled = append(disabled, logType)
+		}
+	}
+	setups := []*eks.LogSetup{}
+	if len(enabled) > 0 {
+		setups = append(setups, &eks.LogSetup{Enabled: aws.Bool(true), Types: aws.StringSlice(enabled)})
+	}
+	if len(disabled) > 0 {
+		setups = append(setups, &eks.LogSetup{Enabled: aws.Bool(false), Types: aws.StringSlice(disabled)})
+	}
+	return &eks.Logging{ClusterLogging: setups}
+}
+
 func describeClusterToModel(cluster eks.Cluster, model *Model) {
 	model.Name = cluster.Name
 	model.RoleArn = cluster.RoleArn
 	model.Version = cluster.Version
 	model.ResourcesVpcConfig = &ResourcesVpcConfig{
-		SecurityGroupIds: aws.StringValueSlice(cluster.ResourcesVpcConfig.SecurityGroupIds),
-		SubnetIds:        aws.StringValueSlice(cluster.ResourcesVpcConfig.SubnetIds),
+		SecurityGroupIds:      aws.StringValueSlice(cluster.ResourcesVpcConfig.SecurityGroupIds),
+		SubnetIds:             aws.StringValueSlice(cluster.ResourcesVpcConfig.SubnetIds),
+		EndpointPublicAccess:  cluster.ResourcesVpcConfig.EndpointPublicAccess,
+		EndpointPrivateAccess: cluster.ResourcesVpcConfig.EndpointPrivateAccess,
+		PublicAccessCidrs:     aws.StringValueSlice(cluster.ResourcesVpcConfig.PublicAccessCidrs),
 	}
 	model.Arn = cluster.Arn
 	model.CertificateAuthorityData = cluster.CertificateAuthority.Data
 	model.ClusterSecurityGroupId = cluster.ResourcesVpcConfig.ClusterSecurityGroupId
 	model.Endpoint = cluster.Endpoint
+	model.VpcId = cluster.ResourcesVpcConfig.VpcId
+	model.PlatformVersion = cluster.PlatformVersion
+	model.Status = cluster.Status
+	model.CreatedAt = nil
+	if cluster.CreatedAt != nil {
+		model.CreatedAt = aws.String(cluster.CreatedAt.UTC().Format(time.RFC3339))
+	}
+	model.OpenIdConnectIssuerUrl = nil
+	if cluster.Identity != nil && cluster.Identity.Oidc != nil {
+		model.OpenIdConnectIssuerUrl = cluster.Identity.Oidc.Issuer
+	}
+	model.OidcProviderArn = nil
+	tags := map[string]*string{}
+	for k, v := range cluster.Tags {
+		if k == oidcProviderTag {
+			model.OidcProviderArn = v
+			continue
+		}
+		tags[k] = v
+	}
+	model.Tags = mapToTags(tags)
+	model.Logging = nil
+	if cluster.Logging != nil {
+		enabled := []string{}
+		for _, setup := range cluster.Logging.ClusterLogging {
+			if aws.BoolValue(setup.Enabled) {
+				enabled = append(enabled, aws.StringValueSlice(setup.Types)...)
+			}
+		}
+		if len(enabled) > 0 {
+			model.Logging = &Logging{EnabledTypes: enabled}
+		}
+	}
 }
 
 func resourceNotFound(err error) bool {
@@ -2,12 +2,15 @@ package resource
 
 import (
 	"errors"
+	"fmt"
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/eks"
 	"github.com/aws/aws-sdk-go/service/eks/eksiface"
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
 	"time"
 )
@@ -23,9 +26,19 @@ type mockEKSClient struct {
 	MockUpdateError   error
 	MockDeleteError   error
 	MockListError     error
+	MockUpdateStatus  string
+	MockUpdateErrors  []*eks.ErrorDetail
+	MockTagError      error
+	TagInput          *eks.TagResourceInput
+	UntagInput        *eks.UntagResourceInput
+	MockNodeGroupList []*string
+	MockListPageSize  int
+	CreateInput       *eks.CreateClusterInput
+	ConfigInput       *eks.UpdateClusterConfigInput
 }
 
 func (m *mockEKSClient) CreateCluster(input *eks.CreateClusterInput) (*eks.CreateClusterOutput, error) {
+	m.CreateInput = input
 	return &eks.CreateClusterOutput{
 		Cluster: &eks.Cluster{
 			Arn: m.MockCluster.Arn,
@@ -65,7 +78,8 @@ func (m *mockEKSClient) CreateCluster(input *eks.CreateClusterInput) (*eks.Creat
 	}, m.MockCreateError
 }
 
-func (m *mockEKSClient) UpdateClusterConfig(_ *eks.UpdateClusterConfigInput) (*eks.UpdateClusterConfigOutput, error) {
+func (m *mockEKSClient) UpdateClusterConfig(input *eks.UpdateClusterConfigInput) (*eks.UpdateClusterConfigOutput, error) {
+	m.ConfigInput = input
 	return &eks.UpdateClusterConfigOutput{
 		Update: &eks.Update{
 			CreatedAt: &time.Time{},
@@ -78,6 +92,52 @@ func (m *mockEKSClient) UpdateClusterConfig(_ *eks.UpdateClusterConfigInput) (*e
 	}, m.MockUpdateError
 }
 
+func (m *mockEKSClient) UpdateClusterVersion(_ *eks.UpdateClusterVersionInput) (*eks.UpdateClusterVersionOutput, error) {
+	return &eks.UpdateClusterVersionOutput{
+		Update: &eks.Update{
+			CreatedAt: &time.Time{},
+			Errors:    nil,
+			Id:        aws.String("VersionId"),
+			Params:    []*eks.UpdateParam{},
+			Status:    aws.String(eks.UpdateStatusInProgress),
+			Type:      aws.String(eks.UpdateTypeVersionUpdate),
+		},
+	}, m.MockUpdateError
+}
+
+func (m *mockEKSClient) DescribeUpdate(input *eks.DescribeUpdateInput) (*eks.DescribeUpdateOutput, error) {
+	return &eks.DescribeUpdateOutput{
+		Update: &eks.Update{
+			CreatedAt: &time.Time{},
+			Errors:    m.MockUpdateErrors,
+			Id:        input.UpdateId,
+			Params:    []*eks.UpdateParam{},
+			Status:    aws.String(m.MockUpdateStatus),
+			Type:      aws.String(eks.UpdateTypeVersionUpdate),
+		},
+	}, m.MockDescribeError
+}
+
+func (m *mockEKSClient) TagResource(input *eks.TagResourceInput) (*eks.TagResourceOutput, error) {
+	m.TagInput = input
+	return &eks.TagResourceOutput{}, m.MockTagError
+}
+
+func (m *mockEKSClient) UntagResource(input *eks.UntagResourceInput) (*eks.UntagResourceOutput, error) {
+	m.UntagInput = input
+	return &eks.UntagResourceOutput{}, m.MockTagError
+}
+
+func (m *mockEKSClient) ListNodegroupsPages(_ *eks.ListNodegroupsInput, fn func(*eks.ListNodegroupsOutput, bool) bool) error {
+	fn(&eks.ListNodegroupsOutput{Nodegroups: m.MockNodeGroupList}, true)
+	return nil
+}
+
+func (m *mockEKSClient) ListFargateProfilesPages(_ *eks.ListFargateProfilesInput, fn func(*eks.ListFargateProfilesOutput, bool) bool) error {
+	fn(&eks.ListFargateProfilesOutput{}, true)
+	return nil
+}
+
 func (m *mockEKSClient) DeleteCluster(input *eks.DeleteClusterInput) (*eks.DeleteClusterOutput, error) {
 	return &eks.DeleteClusterOutput{
 		Cluster: &eks.Cluster{
@@ -126,7 +186,7 @@ func (m *mockEKSClient) DescribeCluster(input *eks.DescribeClusterInput) (*eks.D
 				Data: m.MockCluster.CertificateAuthority.Data,
 			},
 			ClientRequestToken: m.MockCluster.ClientRequestToken,
-			CreatedAt:          &time.Time{},
+			CreatedAt:          m.MockCluster.CreatedAt,
 			Endpoint:           m.MockCluster.Endpoint,
 			Identity: &eks.Identity{
 				Oidc: &eks.OIDC{
@@ -158,10 +218,25 @@ func (m *mockEKSClient) DescribeCluster(input *eks.DescribeClusterInput) (*eks.D
 	}, m.MockDescribeError
 }
 
-func (m *mockEKSClient) ListClusters(_ *eks.ListClustersInput) (*eks.ListClustersOutput, error) {
-	return &eks.ListClustersOutput{
-		Clusters: m.MockClusterList,
-	}, m.MockListError
+func (m *mockEKSClient) ListClusters(input *eks.ListClustersInput) (*eks.ListClustersOutput, error) {
+	if m.MockListPageSize == 0 {
+		return &eks.ListClustersOutput{
+			Clusters: m.MockClusterList,
+		}, m.MockListError
+	}
+	start := 0
+	if input.NextToken != nil {
+		fmt.Sscan(*input.NextToken, &start)
+	}
+	end := start + m.MockListPageSize
+	output := &eks.ListClustersOutput{}
+	if end < len(m.MockClusterList) {
+		output.NextToken = aws.String(fmt.Sprint(end))
+	} else {
+		end = len(m.MockClusterList)
+	}
+	output.Clusters = m.MockClusterList[start:end]
+	return output, m.MockListError
 }
 
 func makeCluster() *eks.Cluster {
@@ -199,28 +274,123 @@ func makeModel() *Model {
 	}
 }
 
+// racingEKSClient finds no cluster on the first DescribeCluster call, as if
+// another invocation created it just after.
+type racingEKSClient struct {
+	*mockEKSClient
+	describes int
+}
+
+func (m *racingEKSClient) DescribeCluster(input *eks.DescribeClusterInput) (*eks.DescribeClusterOutput, error) {
+	m.describes++
+	if m.describes == 1 {
+		return nil, awserr.New(eks.ErrCodeResourceNotFoundException, "mock aws error", anErr)
+	}
+	return m.mockEKSClient.DescribeCluster(input)
+}
+
 func TestCreateCluster(t *testing.T) {
+	notFound := awserr.New(eks.ErrCodeResourceNotFoundException, "mock aws error", anErr)
 	mockSvc := &mockEKSClient{
 		MockCluster: makeCluster(),
 	}
 	mockSvc.MockCluster.Status = aws.String(eks.ClusterStatusCreating)
 
 	model := makeModel()
-	var callbackContext map[string]interface{}
+	var state *callbackState
+	t.Run("name recorded first", func(t *testing.T) {
+		unnamed := makeModel()
+		unnamed.Name = nil
+		progress := createCluster(mockSvc, unnamed, state)
+		assert.Equal(t, handler.InProgress, progress.OperationStatus)
+		assert.Nil(t, mockSvc.CreateInput)
+		state = stateOf(t, progress)
+		assert.Equal(t, phaseCreating, state.Phase)
+		assert.False(t, state.OpComplete)
+		assert.Equal(t, unnamed.Name, state.ClusterName)
+		assert.Len(t, state.ClientRequestToken, 2*clientRequestTokenBytes)
+	})
 	t.Run("in progress", func(t *testing.T) {
-		progress := createCluster(mockSvc, model, callbackContext)
+		mockSvc.MockDescribeError = notFound
+		progress := createCluster(mockSvc, model, state)
 		assert.Equal(t, handler.InProgress, progress.OperationStatus)
+		assert.Equal(t, model.Name, mockSvc.CreateInput.Name)
+		assert.Equal(t, state.ClientRequestToken, aws.StringValue(mockSvc.CreateInput.ClientRequestToken))
+		assert.Nil(t, mockSvc.CreateInput.ResourcesVpcConfig.PublicAccessCidrs)
+		assert.True(t, stateOf(t, progress).OpComplete)
+	})
+	t.Run("tags sent", func(t *testing.T) {
+		taggedModel := makeModel()
+		taggedModel.Tags = []Tag{{Key: aws.String("team"), Value: aws.String("platform")}}
+		progress := createCluster(mockSvc, taggedModel, state)
+		assert.Equal(t, handler.InProgress, progress.OperationStatus)
+		assert.Equal(t, taggedModel.Tags, progress.ResourceModel.(*Model).Tags)
+	})
+	t.Run("invalid endpoint access", func(t *testing.T) {
+		invalidModel := makeModel()
+		invalidModel.ResourcesVpcConfig.EndpointPublicAccess = aws.Bool(false)
+		invalidModel.ResourcesVpcConfig.EndpointPrivateAccess = aws.Bool(false)
+		progress := createCluster(mockSvc, invalidModel, nil)
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
+		assert.Equal(t, cloudformation.HandlerErrorCodeInvalidRequest, progress.HandlerErrorCode)
 	})
 	t.Run("aws api error", func(t *testing.T) {
 		mockSvc.MockCreateError = awserr.New(eks.ErrCodeResourceInUseException, "mock aws error", anErr)
-		progress := createCluster(mockSvc, model, callbackContext)
+		progress := createCluster(mockSvc, model, state)
 		assert.Equal(t, handler.Failed, progress.OperationStatus)
+		mockSvc.MockCreateError = nil
 	})
-	t.Run("success", func(t *testing.T) {
+	t.Run("resumed after a failed call took effect", func(t *testing.T) {
+		mockSvc.MockDescribeError = nil
+		mockSvc.CreateInput = nil
+		resumed := &callbackState{Phase: phaseCreating, StartedAt: "2020-03-01T12:00:00Z"}
+		mockSvc.MockCluster.CreatedAt = aws.Time(time.Date(2020, 3, 1, 12, 0, 5, 0, time.UTC))
+		progress := createCluster(mockSvc, model, resumed)
+		assert.Equal(t, handler.InProgress, progress.OperationStatus)
+		assert.Nil(t, mockSvc.CreateInput)
+		assert.True(t, stateOf(t, progress).OpComplete)
+	})
+	t.Run("name taken by an older cluster", func(t *testing.T) {
+		resumed := &callbackState{Phase: phaseCreating, StartedAt: "2020-03-01T12:00:00Z"}
+		mockSvc.MockCluster.CreatedAt = aws.Time(time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC))
+		progress := createCluster(mockSvc, model, resumed)
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
+		assert.Equal(t, cloudformation.HandlerErrorCodeAlreadyExists, progress.HandlerErrorCode)
+		assert.Nil(t, mockSvc.CreateInput)
+	})
+	t.Run("resumed with the operation's token", func(t *testing.T) {
+		resumed := &callbackState{Phase: phaseCreating, StartedAt: "2020-03-01T12:00:00Z", ClientRequestToken: "token"}
+		mockSvc.MockCluster.ClientRequestToken = aws.String("token")
+		progress := createCluster(mockSvc, model, resumed)
+		assert.Equal(t, handler.InProgress, progress.OperationStatus)
+		assert.Nil(t, mockSvc.CreateInput)
+		assert.True(t, stateOf(t, progress).OpComplete)
+	})
+	t.Run("name taken by another token", func(t *testing.T) {
+		resumed := &callbackState{Phase: phaseCreating, StartedAt: "2020-01-01T00:00:00Z", ClientRequestToken: "other"}
+		progress := createCluster(mockSvc, model, resumed)
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
+		assert.Equal(t, cloudformation.HandlerErrorCodeAlreadyExists, progress.HandlerErrorCode)
+		assert.Nil(t, mockSvc.CreateInput)
+	})
+	t.Run("resource in use with the operation's token", func(t *testing.T) {
+		racing := &racingEKSClient{mockEKSClient: mockSvc}
+		mockSvc.MockCreateError = awserr.New(eks.ErrCodeResourceInUseException, "mock aws error", anErr)
+		resumed := &callbackState{Phase: phaseCreating, ClientRequestToken: "token"}
+		progress := createCluster(racing, model, resumed)
+		assert.Equal(t, handler.InProgress, progress.OperationStatus)
+		assert.True(t, stateOf(t, progress).OpComplete)
+
+		racing = &racingEKSClient{mockEKSClient: mockSvc}
+		resumed.ClientRequestToken = "other"
+		progress = createCluster(racing, model, resumed)
+		assert.Equal(t, cloudformation.HandlerErrorCodeAlreadyExists, progress.HandlerErrorCode)
 		mockSvc.MockCreateError = nil
-		callbackContext = map[string]interface{}{"ClusterName": "test", "OpComplete": true}
+	})
+	t.Run("success", func(t *testing.T) {
+		state = &callbackState{Phase: phaseCreating, OpComplete: true}
 		mockSvc.MockCluster.Status = aws.String(eks.ClusterStatusActive)
-		progress := createCluster(mockSvc, model, callbackContext)
+		progress := createCluster(mockSvc, model, state)
 		assert.Equal(t, handler.Success, progress.OperationStatus)
 	})
 }
@@ -230,31 +400,215 @@ func TestUpdateCluster(t *testing.T) {
 		MockCluster: makeCluster(),
 	}
 	mockSvc.MockCluster.Status = aws.String(eks.ClusterStatusUpdating)
+	mockSvc.MockCluster.Version = aws.String("1.14")
 
+	prevModel := makeModel()
+	prevModel.ResourcesVpcConfig.EndpointPrivateAccess = aws.Bool(true)
 	model := makeModel()
-	var callbackContext map[string]interface{}
+	var state *callbackState
 	t.Run("in progress", func(t *testing.T) {
-		progress := updateCluster(mockSvc, model, callbackContext)
+		progress := updateCluster(mockSvc, prevModel, model, state)
 		assert.Equal(t, handler.InProgress, progress.OperationStatus)
+		assert.Equal(t, "Id", progress.CallbackContext["UpdateId"].(string))
+		assert.Equal(t, []string{updateStepConfig}, progress.CallbackContext["PendingUpdates"])
+		vpcConfig := mockSvc.ConfigInput.ResourcesVpcConfig
+		assert.Equal(t, aws.Bool(false), vpcConfig.EndpointPrivateAccess)
+		assert.Equal(t, aws.Bool(true), vpcConfig.EndpointPublicAccess)
+		assert.Equal(t, defaultPublicAccessCidrs, aws.StringValueSlice(vpcConfig.PublicAccessCidrs))
+		assert.Nil(t, vpcConfig.SubnetIds)
+		assert.Nil(t, vpcConfig.SecurityGroupIds)
 	})
 	t.Run("aws api error", func(t *testing.T) {
 		mockSvc.MockUpdateError = awserr.New(eks.ErrCodeClientException, "mock aws error", anErr)
-		progress := updateCluster(mockSvc, model, callbackContext)
+		progress := updateCluster(mockSvc, prevModel, model, state)
 		assert.Equal(t, handler.Failed, progress.OperationStatus)
 	})
+	t.Run("nothing changed", func(t *testing.T) {
+		progress := updateCluster(mockSvc, makeModel(), model, state)
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+	})
 	t.Run("success", func(t *testing.T) {
-		mockSvc.MockDescribeError = nil
-		mockSvc.MockCluster.Status = aws.String(eks.ClusterStatusActive)
-		callbackContext = map[string]interface{}{"ClusterName": "test", "OpComplete": true}
-		progress := updateCluster(mockSvc, model, callbackContext)
+		mockSvc.MockUpdateError = nil
+		mockSvc.MockUpdateStatus = eks.UpdateStatusSuccessful
+		state = &callbackState{Phase: phaseWaitingUpdate, OpComplete: true, UpdateID: "Id", PendingUpdates: []string{updateStepConfig}}
+		progress := updateCluster(mockSvc, prevModel, model, state)
 		assert.Equal(t, handler.Success, progress.OperationStatus)
 	})
 	t.Run("update already in progress", func(t *testing.T) {
-		callbackContext = nil
+		state = nil
 		mockSvc.MockUpdateError = awserr.New(eks.ErrCodeResourceInUseException, "mock aws error", anErr)
-		progress := updateCluster(mockSvc, model, callbackContext)
+		progress := updateCluster(mockSvc, prevModel, model, state)
 		assert.Equal(t, handler.InProgress, progress.OperationStatus)
-		assert.Equal(t, false, progress.CallbackContext["OpComplete"].(bool))
+		assert.Nil(t, progress.CallbackContext["UpdateId"])
+		assert.Equal(t, []string{updateStepConfig}, progress.CallbackContext["PendingUpdates"])
+	})
+	t.Run("logging update initiated", func(t *testing.T) {
+		mockSvc.MockUpdateError = nil
+		loggingModel := makeModel()
+		loggingModel.Logging = &Logging{EnabledTypes: []string{eks.LogTypeAudit}}
+		progress := updateCluster(mockSvc, makeModel(), loggingModel, nil)
+		assert.Equal(t, handler.InProgress, progress.OperationStatus)
+		assert.Equal(t, "Cluster logging update initiated", progress.Message)
+		assert.Equal(t, []string{updateStepLogging}, progress.CallbackContext["PendingUpdates"])
+	})
+	t.Run("retry pending update", func(t *testing.T) {
+		mockSvc.MockUpdateError = nil
+		state = &callbackState{Phase: phaseUpdating, OpComplete: true, PendingUpdates: []string{updateStepConfig}}
+		progress := updateCluster(mockSvc, prevModel, model, state)
+		assert.Equal(t, handler.InProgress, progress.OperationStatus)
+		assert.Equal(t, "Id", progress.CallbackContext["UpdateId"].(string))
+	})
+}
+
+func TestUpdateClusterVersion(t *testing.T) {
+	mockSvc := &mockEKSClient{
+		MockCluster: makeCluster(),
+	}
+	mockSvc.MockCluster.Status = aws.String(eks.ClusterStatusActive)
+	mockSvc.MockCluster.Version = aws.String("1.14")
+
+	prevModel := makeModel()
+	model := makeModel()
+	model.Version = aws.String("1.15")
+	t.Run("version update initiated", func(t *testing.T) {
+		progress := updateCluster(mockSvc, prevModel, model, nil)
+		assert.Equal(t, handler.InProgress, progress.OperationStatus)
+		assert.Equal(t, "VersionId", progress.CallbackContext["UpdateId"].(string))
+		assert.Equal(t, []string{updateStepVersion}, progress.CallbackContext["PendingUpdates"])
+	})
+	t.Run("multiple hops planned", func(t *testing.T) {
+		model.Version = aws.String("1.17")
+		progress := updateCluster(mockSvc, prevModel, model, nil)
+		assert.Equal(t, handler.InProgress, progress.OperationStatus)
+		assert.Equal(t, []string{"1.15", "1.16", "1.17"}, progress.CallbackContext["VersionPlan"])
+		assert.Equal(t, 0, progress.CallbackContext["VersionHop"])
+		assert.Contains(t, progress.Message, "step 1 of 3")
+	})
+	t.Run("downgrade rejected", func(t *testing.T) {
+		mockSvc.MockCluster.Version = aws.String("1.15")
+		model.Version = aws.String("1.14")
+		newerModel := makeModel()
+		newerModel.Version = aws.String("1.15")
+		progress := updateCluster(mockSvc, newerModel, model, nil)
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
+		assert.Equal(t, cloudformation.HandlerErrorCodeInvalidRequest, progress.HandlerErrorCode)
+		mockSvc.MockCluster.Version = aws.String("1.14")
+	})
+	t.Run("already at desired version", func(t *testing.T) {
+		model.Version = aws.String("1.14")
+		olderModel := makeModel()
+		olderModel.Version = aws.String("1.13")
+		progress := updateCluster(mockSvc, olderModel, model, nil)
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+	})
+	t.Run("update already in progress", func(t *testing.T) {
+		mockSvc.MockUpdateError = awserr.New(eks.ErrCodeResourceInUseException, "mock aws error", anErr)
+		progress := updateClusterVersion(mockSvc, model, []string{updateStepVersion}, []string{"1.15"}, 0)
+		assert.Equal(t, handler.InProgress, progress.OperationStatus)
+		assert.Nil(t, progress.CallbackContext["UpdateId"])
+		assert.Equal(t, []string{updateStepVersion}, progress.CallbackContext["PendingUpdates"])
+	})
+	t.Run("aws api error", func(t *testing.T) {
+		mockSvc.MockUpdateError = awserr.New(eks.ErrCodeInvalidParameterException, "mock aws error", anErr)
+		progress := updateClusterVersion(mockSvc, model, []string{updateStepVersion}, []string{"1.15"}, 0)
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
+	})
+}
+
+func TestUpdateClusterTags(t *testing.T) {
+	mockSvc := &mockEKSClient{
+		MockCluster: makeCluster(),
+	}
+	prevModel := makeModel()
+	prevModel.Tags = []Tag{
+		{Key: aws.String("team"), Value: aws.String("platform")},
+		{Key: aws.String("cost-center"), Value: aws.String("1234")},
+	}
+	makeTaggedModel := func() *Model {
+		model := makeModel()
+		model.Tags = []Tag{
+			{Key: aws.String("team"), Value: aws.String("data")},
+			{Key: aws.String("env"), Value: aws.String("prod")},
+		}
+		return model
+	}
+	t.Run("tags reconciled", func(t *testing.T) {
+		progress := updateCluster(mockSvc, prevModel, makeTaggedModel(), nil)
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+		assert.Equal(t, "MockArn", *mockSvc.TagInput.ResourceArn)
+		assert.Equal(t, map[string]string{"team": "data", "env": "prod"}, aws.StringValueMap(mockSvc.TagInput.Tags))
+		assert.Equal(t, []string{"cost-center"}, aws.StringValueSlice(mockSvc.UntagInput.TagKeys))
+	})
+	t.Run("aws api error", func(t *testing.T) {
+		mockSvc.MockTagError = awserr.New(eks.ErrCodeBadRequestException, "mock aws error", anErr)
+		progress := updateCluster(mockSvc, prevModel, makeTaggedModel(), nil)
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
+	})
+}
+
+func TestStabilizeUpdate(t *testing.T) {
+	mockSvc := &mockEKSClient{
+		MockCluster: makeCluster(),
+	}
+	model := makeModel()
+	state := &callbackState{Phase: phaseWaitingUpdate, OpComplete: true, UpdateID: "VersionId"}
+	t.Run("in progress", func(t *testing.T) {
+		mockSvc.MockUpdateStatus = eks.UpdateStatusInProgress
+		progress := updateCluster(mockSvc, makeModel(), model, state)
+		assert.Equal(t, handler.InProgress, progress.OperationStatus)
+		assert.Equal(t, "VersionId", progress.CallbackContext["UpdateId"].(string))
+	})
+	t.Run("successful", func(t *testing.T) {
+		mockSvc.MockUpdateStatus = eks.UpdateStatusSuccessful
+		progress := updateCluster(mockSvc, makeModel(), model, state)
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+	})
+	t.Run("next hop started", func(t *testing.T) {
+		mockSvc.MockUpdateStatus = eks.UpdateStatusSuccessful
+		hopState := &callbackState{
+			Phase:          phaseWaitingUpdate,
+			OpComplete:     true,
+			UpdateID:       "VersionId",
+			PendingUpdates: []string{updateStepVersion},
+			VersionPlan:    []string{"1.15", "1.16"},
+			VersionHop:     0,
+		}
+		progress := stabilizeUpdate(mockSvc, makeModel(), model, hopState)
+		assert.Equal(t, handler.InProgress, progress.OperationStatus)
+		assert.Equal(t, 1, progress.CallbackContext["VersionHop"])
+		assert.Contains(t, progress.Message, "1.16")
+		assert.Contains(t, progress.Message, "step 2 of 2")
+	})
+	t.Run("next step started", func(t *testing.T) {
+		mockSvc.MockUpdateStatus = eks.UpdateStatusSuccessful
+		mockSvc.MockCluster.Version = aws.String("1.14")
+		model.Version = aws.String("1.15")
+		stepState := &callbackState{
+			Phase:          phaseWaitingUpdate,
+			OpComplete:     true,
+			UpdateID:       "Id",
+			PendingUpdates: []string{updateStepConfig, updateStepVersion},
+		}
+		progress := stabilizeUpdate(mockSvc, makeModel(), model, stepState)
+		assert.Equal(t, handler.InProgress, progress.OperationStatus)
+		assert.Equal(t, "VersionId", progress.CallbackContext["UpdateId"])
+		assert.Equal(t, []string{updateStepVersion}, progress.CallbackContext["PendingUpdates"])
+	})
+	t.Run("failed", func(t *testing.T) {
+		mockSvc.MockUpdateStatus = eks.UpdateStatusFailed
+		mockSvc.MockUpdateErrors = []*eks.ErrorDetail{{
+			ErrorCode:    aws.String(eks.ErrorCodeAccessDenied),
+			ErrorMessage: aws.String("role cannot be assumed"),
+		}}
+		progress := stabilizeUpdate(mockSvc, makeModel(), model, state)
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
+		assert.Equal(t, cloudformation.HandlerErrorCodeAccessDenied, progress.HandlerErrorCode)
+		assert.Contains(t, progress.Message, "role cannot be assumed")
+	})
+	t.Run("aws api error", func(t *testing.T) {
+		mockSvc.MockDescribeError = awserr.New(eks.ErrCodeClientException, "mock aws error", anErr)
+		progress := stabilizeUpdate(mockSvc, makeModel(), model, state)
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
 	})
 }
 
@@ -265,29 +619,35 @@ func TestDeleteCluster(t *testing.T) {
 	mockSvc.MockCluster.Status = aws.String(eks.ClusterStatusDeleting)
 
 	model := makeModel()
-	var callbackContext map[string]interface{}
+	var state *callbackState
 	t.Run("in progress", func(t *testing.T) {
-		progress := deleteCluster(mockSvc, model, callbackContext)
+		progress := deleteCluster(mockSvc, model, state)
 		assert.Equal(t, handler.InProgress, progress.OperationStatus)
 	})
 	t.Run("aws api error", func(t *testing.T) {
 		mockSvc.MockDeleteError = awserr.New(eks.ErrCodeClientException, "mock aws error", anErr)
-		progress := deleteCluster(mockSvc, model, callbackContext)
+		progress := deleteCluster(mockSvc, model, state)
 		assert.Equal(t, handler.Failed, progress.OperationStatus)
 	})
 	t.Run("success", func(t *testing.T) {
 		mockSvc.MockDescribeError = awserr.New(eks.ErrCodeResourceNotFoundException, "mock aws error", anErr)
-		callbackContext = map[string]interface{}{"ClusterName": "test", "OpComplete": true}
-		progress := deleteCluster(mockSvc, model, callbackContext)
+		state = &callbackState{Phase: phaseDeleting, OpComplete: true}
+		progress := deleteCluster(mockSvc, model, state)
 		assert.Equal(t, handler.Success, progress.OperationStatus)
 	})
 	t.Run("update in progress", func(t *testing.T) {
-		callbackContext = nil
+		state = nil
 		mockSvc.MockDeleteError = awserr.New(eks.ErrCodeResourceInUseException, "mock aws error", anErr)
-		progress := deleteCluster(mockSvc, model, callbackContext)
+		progress := deleteCluster(mockSvc, model, state)
 		assert.Equal(t, handler.InProgress, progress.OperationStatus)
 		assert.Equal(t, false, progress.CallbackContext["OpComplete"].(bool))
 	})
+	t.Run("blocked by dependents", func(t *testing.T) {
+		mockSvc.MockNodeGroupList = aws.StringSlice([]string{"workers"})
+		progress := deleteCluster(mockSvc, model, state)
+		assert.Equal(t, handler.InProgress, progress.OperationStatus)
+		assert.Equal(t, "cluster deletion is waiting on node groups workers", progress.Message)
+	})
 }
 
 func TestStabilize(t *testing.T) {
@@ -344,25 +704,37 @@ func TestListCluster(t *testing.T) {
 	}
 	t.Run("empty response", func(t *testing.T) {
 		mockSvc.MockClusterList = []*string{}
-		progress := listClusters(mockSvc)
+		progress := listClusters(mockSvc, nil)
 		assert.Equal(t, handler.Success, progress.OperationStatus)
-		assert.Equal(t, 1, len(progress.ResourceModels))
+		assert.Empty(t, progress.ResourceModels)
 	})
-	t.Run("success", func(t *testing.T) {
+	t.Run("identifiers only", func(t *testing.T) {
 		mockSvc.MockClusterList = []*string{aws.String("cluster1"), aws.String("cluster2")}
-		progress := listClusters(mockSvc)
+		mockSvc.MockDescribeError = awserr.New(eks.ErrCodeClientException, "mock aws error", anErr)
+		progress := listClusters(mockSvc, nil)
 		assert.Equal(t, handler.Success, progress.OperationStatus)
-		assert.Equal(t, 3, len(progress.ResourceModels))
+		assert.Equal(t, []interface{}{&Model{Name: aws.String("cluster1")}, &Model{Name: aws.String("cluster2")}}, progress.ResourceModels)
+		mockSvc.MockDescribeError = nil
 	})
-	t.Run("describe error", func(t *testing.T) {
-		mockSvc.MockDescribeError = awserr.New(eks.ErrCodeClientException, "mock aws error", anErr)
-		progress := listClusters(mockSvc)
-		assert.Equal(t, handler.Failed, progress.OperationStatus)
+	t.Run("paginated", func(t *testing.T) {
+		mockSvc.MockClusterList = aws.StringSlice([]string{"a", "b", "c"})
+		mockSvc.MockListPageSize = 2
+		progress := listClusters(mockSvc, nil)
+		assert.Len(t, progress.ResourceModels, 2)
+		assert.Equal(t, "2", progress.NextToken)
+		progress = listClusters(mockSvc, aws.String(progress.NextToken))
+		assert.Len(t, progress.ResourceModels, 1)
+		assert.Empty(t, progress.NextToken)
+		progress = listAllClusters(mockSvc)
+		assert.Len(t, progress.ResourceModels, 3)
+		assert.Empty(t, progress.NextToken)
+		mockSvc.MockListPageSize = 0
 	})
 	t.Run("list error", func(t *testing.T) {
-		mockSvc.MockDescribeError = nil
 		mockSvc.MockListError = awserr.New(eks.ErrCodeClientException, "mock aws error", anErr)
-		progress := listClusters(mockSvc)
+		progress := listClusters(mockSvc, nil)
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
+		progress = listAllClusters(mockSvc)
 		assert.Equal(t, handler.Failed, progress.OperationStatus)
 	})
 }
@@ -396,11 +768,26 @@ func TestDescribeClusterToModel(t *testing.T) {
 		Endpoint:             aws.String("Endpoint"),
 		Name:                 aws.String("Name"),
 		ResourcesVpcConfig: &eks.VpcConfigResponse{
-			SecurityGroupIds: []*string{aws.String("sg-1"), aws.String("sg-2")},
-			SubnetIds:        []*string{aws.String("subnet-1"), aws.String("subnet-2")},
+			VpcId:                 aws.String("vpc-1"),
+			SecurityGroupIds:      []*string{aws.String("sg-1"), aws.String("sg-2")},
+			SubnetIds:             []*string{aws.String("subnet-1"), aws.String("subnet-2")},
+			EndpointPublicAccess:  aws.Bool(false),
+			EndpointPrivateAccess: aws.Bool(true),
+			PublicAccessCidrs:     []*string{aws.String("0.0.0.0/0")},
 		},
 		RoleArn: aws.String("RoleArn"),
 		Version: aws.String("Version"),
+		Tags:    map[string]*string{"team": aws.String("platform")},
+		Identity: &eks.Identity{
+			Oidc: &eks.OIDC{Issuer: aws.String("https://oidc.eks.us-west-2.amazonaws.com/id/EXAMPLE")},
+		},
+		PlatformVersion: aws.String("eks.9"),
+		Status:          aws.String(eks.ClusterStatusActive),
+		CreatedAt:       aws.Time(time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)),
+		Logging: &eks.Logging{ClusterLogging: []*eks.LogSetup{
+			{Enabled: aws.Bool(true), Types: []*string{aws.String(eks.LogTypeAudit)}},
+			{Enabled: aws.Bool(false), Types: []*string{aws.String(eks.LogTypeApi)}},
+		}},
 	}
 	model := Model{}
 	describeClusterToModel(cluster, &model)
@@ -413,8 +800,19 @@ func TestDescribeClusterToModel(t *testing.T) {
 		{"security group 2", model.ResourcesVpcConfig.SecurityGroupIds[1], *cluster.ResourcesVpcConfig.SecurityGroupIds[1]},
 		{"subnet 1", model.ResourcesVpcConfig.SubnetIds[0], *cluster.ResourcesVpcConfig.SubnetIds[0]},
 		{"subnet 2", model.ResourcesVpcConfig.SubnetIds[1], *cluster.ResourcesVpcConfig.SubnetIds[1]},
+		{"EndpointPublicAccess", fmt.Sprint(*model.ResourcesVpcConfig.EndpointPublicAccess), "false"},
+		{"EndpointPrivateAccess", fmt.Sprint(*model.ResourcesVpcConfig.EndpointPrivateAccess), "true"},
+		{"PublicAccessCidrs", model.ResourcesVpcConfig.PublicAccessCidrs[0], *cluster.ResourcesVpcConfig.PublicAccessCidrs[0]},
 		{"RoleArn", *model.RoleArn, *cluster.RoleArn},
 		{"Version", *model.Version, *cluster.Version},
+		{"Logging", strings.Join(model.Logging.EnabledTypes, ","), eks.LogTypeAudit},
+		{"OpenIdConnectIssuerUrl", *model.OpenIdConnectIssuerUrl, *cluster.Identity.Oidc.Issuer},
+		{"PlatformVersion", *model.PlatformVersion, *cluster.PlatformVersion},
+		{"VpcId", *model.VpcId, *cluster.ResourcesVpcConfig.VpcId},
+		{"Status", *model.Status, *cluster.Status},
+		{"CreatedAt", *model.CreatedAt, "2020-03-01T12:00:00Z"},
+		{"Tag key", *model.Tags[0].Key, "team"},
+		{"Tag value", *model.Tags[0].Value, *cluster.Tags["team"]},
 	}
 	for _, tc := range cases {
 		t.Run(tc.Name, func(t *testing.T) {
@@ -423,6 +821,28 @@ func TestDescribeClusterToModel(t *testing.T) {
 	}
 }
 
+func TestClusterLogging(t *testing.T) {
+	t.Run("nothing enabled", func(t *testing.T) {
+		logging := clusterLogging(nil)
+		assert.Len(t, logging.ClusterLogging, 1)
+		assert.False(t, *logging.ClusterLogging[0].Enabled)
+		assert.Len(t, logging.ClusterLogging[0].Types, len(logTypes))
+	})
+	t.Run("some enabled", func(t *testing.T) {
+		logging := clusterLogging(&Logging{EnabledTypes: []string{eks.LogTypeAudit, eks.LogTypeAuthenticator}})
+		assert.Len(t, logging.ClusterLogging, 2)
+		assert.True(t, *logging.ClusterLogging[0].Enabled)
+		assert.Equal(t, []string{eks.LogTypeAudit, eks.LogTypeAuthenticator}, aws.StringValueSlice(logging.ClusterLogging[0].Types))
+		assert.False(t, *logging.ClusterLogging[1].Enabled)
+		assert.Len(t, logging.ClusterLogging[1].Types, len(logTypes)-2)
+	})
+	t.Run("all enabled", func(t *testing.T) {
+		logging := clusterLogging(&Logging{EnabledTypes: logTypes})
+		assert.Len(t, logging.ClusterLogging, 1)
+		assert.True(t, *logging.ClusterLogging[0].Enabled)
+	})
+}
+
 func makeAwsError(code string) error {
 	return awserr.New(code, "generated error", errors.New("original error"))
 }
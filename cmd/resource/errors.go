@@ -0,0 +1,61 @@
+package resource
+
+import (
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// errorCodes maps the error codes returned by EKS, IAM, EC2 and S3 to the
+// CloudFormation handler error codes they should be reported with.
+var errorCodes = map[string]string{
+	eks.ErrCodeResourceNotFoundException:            cloudformation.HandlerErrorCodeNotFound,
+	eks.ErrCodeNotFoundException:                    cloudformation.HandlerErrorCodeNotFound,
+	eks.ErrCodeResourceInUseException:               cloudformation.HandlerErrorCodeAlreadyExists,
+	eks.ErrCodeResourceLimitExceededException:       cloudformation.HandlerErrorCodeServiceLimitExceeded,
+	eks.ErrCodeInvalidParameterException:            cloudformation.HandlerErrorCodeInvalidRequest,
+	eks.ErrCodeInvalidRequestException:              cloudformation.HandlerErrorCodeInvalidRequest,
+	eks.ErrCodeBadRequestException:                  cloudformation.HandlerErrorCodeInvalidRequest,
+	eks.ErrCodeUnsupportedAvailabilityZoneException: cloudformation.HandlerErrorCodeInvalidRequest,
+	eks.ErrCodeClientException:                      cloudformation.HandlerErrorCodeInvalidRequest,
+	eks.ErrCodeServerException:                      cloudformation.HandlerErrorCodeServiceInternalError,
+	eks.ErrCodeServiceUnavailableException:          cloudformation.HandlerErrorCodeServiceInternalError,
+	iam.ErrCodeNoSuchEntityException:                cloudformation.HandlerErrorCodeNotFound,
+	iam.ErrCodeEntityAlreadyExistsException:         cloudformation.HandlerErrorCodeAlreadyExists,
+	iam.ErrCodeLimitExceededException:               cloudformation.HandlerErrorCodeServiceLimitExceeded,
+	iam.ErrCodeInvalidInputException:                cloudformation.HandlerErrorCodeInvalidRequest,
+	iam.ErrCodeServiceFailureException:              cloudformation.HandlerErrorCodeServiceInternalError,
+	s3.ErrCodeNoSuchBucket:                          cloudformation.HandlerErrorCodeInvalidRequest,
+	s3.ErrCodeNoSuchKey:                             cloudformation.HandlerErrorCodeInvalidRequest,
+	"AccessDeniedException":                         cloudformation.HandlerErrorCodeAccessDenied,
+	"AccessDenied":                                  cloudformation.HandlerErrorCodeAccessDenied,
+	"UnauthorizedOperation":                         cloudformation.HandlerErrorCodeAccessDenied,
+	"UnrecognizedClientException":                   cloudformation.HandlerErrorCodeInvalidCredentials,
+	"InvalidClientTokenId":                          cloudformation.HandlerErrorCodeInvalidCredentials,
+	"ExpiredTokenException":                         cloudformation.HandlerErrorCodeInvalidCredentials,
+	"ExpiredToken":                                  cloudformation.HandlerErrorCodeInvalidCredentials,
+	request.ErrCodeRequestError:                     cloudformation.HandlerErrorCodeNetworkFailure,
+	request.ErrCodeResponseTimeout:                  cloudformation.HandlerErrorCodeNetworkFailure,
+}
+
+// handlerErrorCode classifies an error as a CloudFormation handler error
+// code. Errors raised by the handlers carry their own code, throttling is
+// recognised however the service names it, and anything unrecognised is a
+// GeneralServiceException.
+func handlerErrorCode(err error) string {
+	if herr, ok := err.(*handlerError); ok {
+		return herr.code
+	}
+	if aerr, ok := err.(awserr.Error); ok {
+		if request.IsErrorThrottle(err) {
+			return cloudformation.HandlerErrorCodeThrottling
+		}
+		if code, ok := errorCodes[aerr.Code()]; ok {
+			return code
+		}
+	}
+	return cloudformation.HandlerErrorCodeGeneralServiceException
+}
@@ -0,0 +1,72 @@
+package resource
+
+import (
+	"errors"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestHandlerErrorCode(t *testing.T) {
+	cases := []struct {
+		Err      error
+		Expected string
+	}{
+		{makeAwsError(eks.ErrCodeResourceNotFoundException), cloudformation.HandlerErrorCodeNotFound},
+		{makeAwsError(eks.ErrCodeServerException), cloudformation.HandlerErrorCodeServiceInternalError},
+		{makeAwsError(eks.ErrCodeServiceUnavailableException), cloudformation.HandlerErrorCodeServiceInternalError},
+		{makeAwsError(eks.ErrCodeClientException), cloudformation.HandlerErrorCodeInvalidRequest},
+		{makeAwsError(eks.ErrCodeInvalidRequestException), cloudformation.HandlerErrorCodeInvalidRequest},
+		{makeAwsError("ThrottlingException"), cloudformation.HandlerErrorCodeThrottling},
+		{makeAwsError("TooManyRequestsException"), cloudformation.HandlerErrorCodeThrottling},
+		{makeAwsError("AccessDeniedException"), cloudformation.HandlerErrorCodeAccessDenied},
+		{makeAwsError("ExpiredTokenException"), cloudformation.HandlerErrorCodeInvalidCredentials},
+		{makeAwsError(request.ErrCodeRequestError), cloudformation.HandlerErrorCodeNetworkFailure},
+		{makeAwsError(iam.ErrCodeNoSuchEntityException), cloudformation.HandlerErrorCodeNotFound},
+		{makeAwsError(iam.ErrCodeLimitExceededException), cloudformation.HandlerErrorCodeServiceLimitExceeded},
+		{invalidRequestError("invalid"), cloudformation.HandlerErrorCodeInvalidRequest},
+		{errors.New("arbitrary error"), cloudformation.HandlerErrorCodeGeneralServiceException},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Err.Error(), func(t *testing.T) {
+			assert.Equal(t, tc.Expected, handlerErrorCode(tc.Err))
+		})
+	}
+}
+
+func TestMissingClusterIsNotFound(t *testing.T) {
+	mockSvc := &mockEKSClient{
+		MockCluster:       makeCluster(),
+		MockDescribeError: makeAwsError(eks.ErrCodeResourceNotFoundException),
+		MockUpdateError:   makeAwsError(eks.ErrCodeResourceNotFoundException),
+		MockDeleteError:   makeAwsError(eks.ErrCodeResourceNotFoundException),
+	}
+	t.Run("read", func(t *testing.T) {
+		progress := describeCluster(mockSvc, makeModel())
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
+		assert.Equal(t, cloudformation.HandlerErrorCodeNotFound, progress.HandlerErrorCode)
+	})
+	t.Run("update", func(t *testing.T) {
+		prevModel := makeModel()
+		model := makeModel()
+		model.ResourcesVpcConfig.EndpointPrivateAccess = aws.Bool(true)
+		progress := updateCluster(mockSvc, prevModel, model, nil)
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
+		assert.Equal(t, cloudformation.HandlerErrorCodeNotFound, progress.HandlerErrorCode)
+	})
+	t.Run("update without changes", func(t *testing.T) {
+		progress := updateCluster(mockSvc, makeModel(), makeModel(), nil)
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
+		assert.Equal(t, cloudformation.HandlerErrorCodeNotFound, progress.HandlerErrorCode)
+	})
+	t.Run("delete", func(t *testing.T) {
+		progress := deleteCluster(mockSvc, makeModel(), nil)
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
+		assert.Equal(t, cloudformation.HandlerErrorCodeNotFound, progress.HandlerErrorCode)
+	})
+}
@@ -1,40 +1,82 @@
 package resource
 
 import (
+	"fmt"
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
-	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/eks"
+	"strings"
 )
 
 const (
 	callbackDelay int64 = 120
+	// retryCallbackDelay is the longer delay used when an invocation gives
+	// up on a throttled or failing service, to give it time to recover.
+	retryCallbackDelay int64 = 300
 )
 
 func errorEvent(model *Model, err error) handler.ProgressEvent {
-	errorType := cloudformation.HandlerErrorCodeGeneralServiceException
-	if aerr, ok := err.(awserr.Error); ok {
-		switch aerr.Code() {
-		case eks.ErrCodeResourceLimitExceededException:
-			errorType = cloudformation.HandlerErrorCodeServiceLimitExceeded
-		case eks.ErrCodeInvalidParameterException:
-			errorType = cloudformation.HandlerErrorCodeInvalidRequest
-		case eks.ErrCodeUnsupportedAvailabilityZoneException:
-			errorType = cloudformation.HandlerErrorCodeInvalidRequest
-		case eks.ErrCodeNotFoundException:
-			errorType = cloudformation.HandlerErrorCodeNotFound
-		case eks.ErrCodeResourceInUseException:
-			errorType = cloudformation.HandlerErrorCodeAlreadyExists
-		}
-	}
 	return handler.ProgressEvent{
 		OperationStatus:  handler.Failed,
-		HandlerErrorCode: errorType,
+		HandlerErrorCode: handlerErrorCode(err),
 		Message:          err.Error(),
 		ResourceModel:    model,
 	}
 }
 
+// updateFailedEvent reports an EKS update that failed or was cancelled,
+// including every error EKS recorded against it.
+func updateFailedEvent(model *Model, update *eks.Update) handler.ProgressEvent {
+	return errorEvent(model, updateError("cluster", update))
+}
+
+func invalidRequestEvent(model *Model, message string) handler.ProgressEvent {
+	return errorEvent(model, invalidRequestError(message))
+}
+
+// handlerError is an error raised by the handlers themselves, which already
+// knows the CloudFormation handler error code it should be reported with.
+type handlerError struct {
+	code    string
+	message string
+}
+
+func (e *handlerError) Error() string {
+	return e.message
+}
+
+func invalidRequestError(message string) error {
+	return &handlerError{code: cloudformation.HandlerErrorCodeInvalidRequest, message: message}
+}
+
+// describeError prefixes the message of err with what it concerns, keeping
+// the handler error code err is classified as.
+func describeError(subject string, err error) error {
+	return &handlerError{code: handlerErrorCode(err), message: subject + ": " + err.Error()}
+}
+
+// updateError describes an EKS update of subject that failed or was cancelled.
+func updateError(subject string, update *eks.Update) error {
+	message := fmt.Sprintf("%s update %s status is %s", subject, aws.StringValue(update.Id), aws.StringValue(update.Status))
+	errorType := cloudformation.HandlerErrorCodeNotStabilized
+	for _, detail := range update.Errors {
+		message += fmt.Sprintf("; %s: %s", aws.StringValue(detail.ErrorCode), aws.StringValue(detail.ErrorMessage))
+		if len(detail.ResourceIds) > 0 {
+			message += " (" + strings.Join(aws.StringValueSlice(detail.ResourceIds), ", ") + ")"
+		}
+		switch aws.StringValue(detail.ErrorCode) {
+		case eks.ErrorCodeAccessDenied:
+			errorType = cloudformation.HandlerErrorCodeAccessDenied
+		case eks.ErrorCodeSubnetNotFound, eks.ErrorCodeSecurityGroupNotFound, eks.ErrorCodeVpcIdNotFound:
+			errorType = cloudformation.HandlerErrorCodeInvalidRequest
+		case eks.ErrorCodeEniLimitReached, eks.ErrorCodeIpNotAvailable, eks.ErrorCodeInsufficientFreeAddresses:
+			errorType = cloudformation.HandlerErrorCodeServiceLimitExceeded
+		}
+	}
+	return &handlerError{code: errorType, message: message}
+}
+
 func successEvent(model *Model) handler.ProgressEvent {
 	return handler.ProgressEvent{
 		OperationStatus: handler.Success,
@@ -42,12 +84,102 @@ func successEvent(model *Model) handler.ProgressEvent {
 	}
 }
 
-func inProgressEvent(model *Model, message string, opComplete bool) handler.ProgressEvent {
+func inProgressEvent(model *Model, message string, state *callbackState) handler.ProgressEvent {
+	state.Version = callbackStateVersion
+	state.ClusterName = model.Name
 	return handler.ProgressEvent{
 		OperationStatus:      handler.InProgress,
 		ResourceModel:        model,
 		Message:              message,
-		CallbackContext:      map[string]interface{}{"ClusterName": model.Name, "OpComplete": opComplete},
+		CallbackContext:      state.context(),
 		CallbackDelaySeconds: callbackDelay,
 	}
 }
+
+func pendingUpdateEvent(model *Model, message string, pending []string) handler.ProgressEvent {
+	return inProgressEvent(model, message, &callbackState{Phase: phaseUpdating, OpComplete: true, PendingUpdates: pending})
+}
+
+func updateInProgressEvent(model *Model, message string, updateID string, pending []string) handler.ProgressEvent {
+	return inProgressEvent(model, message, &callbackState{
+		Phase:          phaseWaitingUpdate,
+		OpComplete:     true,
+		UpdateID:       updateID,
+		PendingUpdates: pending,
+	})
+}
+
+func versionUpdateInProgressEvent(model *Model, message string, updateID string, pending []string, plan []string, hop int) handler.ProgressEvent {
+	return inProgressEvent(model, message, &callbackState{
+		Phase:          phaseWaitingUpdate,
+		OpComplete:     true,
+		UpdateID:       updateID,
+		PendingUpdates: pending,
+		VersionPlan:    plan,
+		VersionHop:     hop,
+	})
+}
+
+// nodeGroupUpgradeInProgressEvent waits on node groups being upgraded to the
+// version of a completed hop of a cluster version update.
+func nodeGroupUpgradeInProgressEvent(model *Model, message string, pending []string, plan []string, hop int, statuses map[string]string, updates map[string]string) handler.ProgressEvent {
+	return inProgressEvent(model, message, &callbackState{
+		Phase:            phaseUpgradingNodeGroups,
+		OpComplete:       true,
+		PendingUpdates:   pending,
+		VersionPlan:      plan,
+		VersionHop:       hop,
+		NodeGroups:       statuses,
+		NodeGroupUpdates: updates,
+	})
+}
+
+func nodeGroupInProgressEvent(model *Model, message string, statuses map[string]string, updates map[string]string) handler.ProgressEvent {
+	return inProgressEvent(model, message, &callbackState{
+		Phase:            phaseNodeGroups,
+		OpComplete:       true,
+		NodeGroups:       statuses,
+		NodeGroupUpdates: updates,
+	})
+}
+
+// manifestInProgressEvent records the manifest objects that have been
+// applied or deleted so far.
+func manifestInProgressEvent(model *Model, message string, done []string) handler.ProgressEvent {
+	return inProgressEvent(model, message, &callbackState{
+		Phase:           phaseManifests,
+		OpComplete:      true,
+		ManifestObjects: done,
+	})
+}
+
+func fargateProfileInProgressEvent(model *Model, name string, status string) handler.ProgressEvent {
+	return inProgressEvent(model, "Fargate profile "+name+" "+status, &callbackState{
+		Phase:          phaseFargateProfiles,
+		OpComplete:     true,
+		FargateProfile: name,
+	})
+}
+
+// invalidContextEvent reports a callback context that cannot be read, which
+// the handler cannot safely continue from.
+func invalidContextEvent(model *Model, err error) handler.ProgressEvent {
+	return errorEvent(model, &handlerError{code: cloudformation.HandlerErrorCodeInternalFailure, message: err.Error()})
+}
+
+// retryLaterEvent turns a failure caused by throttling or a transient service
+// error, which persisted through the invocation's retry budget, into an
+// in-progress event. The unchanged callback context makes the next
+// invocation repeat the same step.
+func retryLaterEvent(progress handler.ProgressEvent, callbackContext map[string]interface{}) handler.ProgressEvent {
+	if progress.OperationStatus != handler.Failed || !retryableErrorCode(progress.HandlerErrorCode) {
+		return progress
+	}
+	return handler.ProgressEvent{
+		OperationStatus:      handler.InProgress,
+		ResourceModel:        progress.ResourceModel,
+		Message:              progress.Message + "; retrying",
+		CallbackContext:      callbackContext,
+		CallbackDelaySeconds: retryCallbackDelay,
+	}
+}
@@ -3,9 +3,11 @@ package resource
 import (
 	"errors"
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/eks"
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
 )
 
@@ -19,6 +21,7 @@ func TestErrorEvent(t *testing.T) {
 		{makeAwsError(eks.ErrCodeInvalidParameterException), cloudformation.HandlerErrorCodeInvalidRequest},
 		{makeAwsError(eks.ErrCodeUnsupportedAvailabilityZoneException), cloudformation.HandlerErrorCodeInvalidRequest},
 		{makeAwsError(eks.ErrCodeNotFoundException), cloudformation.HandlerErrorCodeNotFound},
+		{makeAwsError(eks.ErrCodeResourceNotFoundException), cloudformation.HandlerErrorCodeNotFound},
 		{makeAwsError(eks.ErrCodeResourceInUseException), cloudformation.HandlerErrorCodeAlreadyExists},
 		{makeAwsError("arbitrary aws error"), cloudformation.HandlerErrorCodeGeneralServiceException},
 	}
@@ -41,9 +44,57 @@ func TestSuccessEvent(t *testing.T) {
 
 func TestInProgressEvent(t *testing.T) {
 	clusterName := "clusterName"
-	progressEvent := inProgressEvent(&Model{Name: &clusterName}, "message", true)
+	progressEvent := inProgressEvent(&Model{Name: &clusterName}, "message", &callbackState{Phase: phaseCreating, OpComplete: true})
 	assert.Equal(t, handler.InProgress, progressEvent.OperationStatus)
 	assert.Equal(t, callbackDelay, progressEvent.CallbackDelaySeconds)
 	assert.Equal(t, clusterName, *progressEvent.CallbackContext["ClusterName"].(*string))
+	assert.Equal(t, callbackStateVersion, progressEvent.CallbackContext["Version"])
+	assert.Equal(t, phaseCreating, progressEvent.CallbackContext["Phase"])
 	assert.Equal(t, "message", progressEvent.Message)
 }
+
+func TestUpdateFailedEvent(t *testing.T) {
+	update := &eks.Update{
+		Id:     aws.String("Id"),
+		Status: aws.String(eks.UpdateStatusFailed),
+		Errors: []*eks.ErrorDetail{{
+			ErrorCode:    aws.String(eks.ErrorCodeSubnetNotFound),
+			ErrorMessage: aws.String("subnets not found"),
+			ResourceIds:  []*string{aws.String("subnet-1"), aws.String("subnet-2")},
+		}},
+	}
+	progressEvent := updateFailedEvent(&Model{}, update)
+	assert.Equal(t, handler.Failed, progressEvent.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeInvalidRequest, progressEvent.HandlerErrorCode)
+	assert.Equal(t, "cluster update Id status is Failed; SubnetNotFound: subnets not found (subnet-1, subnet-2)", progressEvent.Message)
+
+	update.Errors = nil
+	progressEvent = updateFailedEvent(&Model{}, update)
+	assert.Equal(t, cloudformation.HandlerErrorCodeNotStabilized, progressEvent.HandlerErrorCode)
+	assert.Equal(t, "cluster update Id status is Failed", progressEvent.Message)
+}
+
+func TestInvalidRequestEvent(t *testing.T) {
+	progressEvent := invalidRequestEvent(&Model{}, "message")
+	assert.Equal(t, handler.Failed, progressEvent.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeInvalidRequest, progressEvent.HandlerErrorCode)
+	assert.Equal(t, "message", progressEvent.Message)
+}
+
+func TestDescribeError(t *testing.T) {
+	err := describeError("manifest object Namespace/default/team-a", makeAwsError("ThrottlingException"))
+	assert.Equal(t, cloudformation.HandlerErrorCodeThrottling, handlerErrorCode(err))
+	assert.True(t, strings.HasPrefix(err.Error(), "manifest object Namespace/default/team-a: ThrottlingException"))
+}
+
+func TestRetryLaterEvent(t *testing.T) {
+	callbackContext := map[string]interface{}{"PendingUpdates": []string{updateStepTags}}
+	progress := retryLaterEvent(errorEvent(&Model{}, makeAwsError("ThrottlingException")), callbackContext)
+	assert.Equal(t, handler.InProgress, progress.OperationStatus)
+	assert.Equal(t, callbackContext, progress.CallbackContext)
+	assert.Equal(t, retryCallbackDelay, progress.CallbackDelaySeconds)
+	progress = retryLaterEvent(errorEvent(&Model{}, makeAwsError(eks.ErrCodeInvalidParameterException)), callbackContext)
+	assert.Equal(t, handler.Failed, progress.OperationStatus)
+	progress = retryLaterEvent(successEvent(&Model{}), callbackContext)
+	assert.Equal(t, handler.Success, progress.OperationStatus)
+}
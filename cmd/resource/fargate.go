@@ -0,0 +1,203 @@
+package resource
+
+import (
+	"fmt"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	"sort"
+	"strings"
+)
+
+// reconcileFargateProfiles drives the cluster's Fargate profiles towards the
+// model. EKS only allows one Fargate profile operation per cluster at a time,
+// so at most one profile is created or deleted per invocation and the handler
+// waits for it to settle before moving on. Removed profiles are deleted first,
+// then missing profiles are created. Profiles cannot be updated in place, so a
+// profile whose definition changed is deleted and created again.
+func reconcileFargateProfiles(svc eksiface.EKSAPI, prevModel *Model, model *Model) handler.ProgressEvent {
+	for _, name := range removedFargateProfiles(prevModel, model) {
+		status, err := deleteFargateProfile(svc, model.Name, name)
+		if err != nil {
+			return errorEvent(model, err)
+		}
+		if status != "" {
+			return fargateProfileInProgressEvent(model, name, status)
+		}
+	}
+	for _, profile := range model.FargateProfiles {
+		status, err := reconcileFargateProfile(svc, model, profile)
+		if err != nil {
+			return errorEvent(model, err)
+		}
+		if status != eks.FargateProfileStatusActive {
+			return fargateProfileInProgressEvent(model, aws.StringValue(profile.Name), status)
+		}
+	}
+	return successEvent(model)
+}
+
+// deleteFargateProfiles deletes the named Fargate profiles one at a time,
+// reporting success once they are all gone.
+func deleteFargateProfiles(svc eksiface.EKSAPI, model *Model, names []string) handler.ProgressEvent {
+	for _, name := range names {
+		status, err := deleteFargateProfile(svc, model.Name, name)
+		if err != nil {
+			return errorEvent(model, err)
+		}
+		if status != "" {
+			return fargateProfileInProgressEvent(model, name, status)
+		}
+	}
+	return successEvent(model)
+}
+
+// reconcileFargateProfile moves a single Fargate profile one step towards the
+// model and returns its status.
+func reconcileFargateProfile(svc eksiface.EKSAPI, model *Model, profile FargateProfile) (string, error) {
+	response, err := svc.DescribeFargateProfile(&eks.DescribeFargateProfileInput{
+		ClusterName:        model.Name,
+		FargateProfileName: profile.Name,
+	})
+	if err != nil {
+		if resourceNotFound(err) {
+			return createFargateProfile(svc, model, profile)
+		}
+		return "", err
+	}
+	status := aws.StringValue(response.FargateProfile.Status)
+	switch status {
+	case eks.FargateProfileStatusCreateFailed, eks.FargateProfileStatusDeleteFailed:
+		return "", fmt.Errorf("Fargate profile %s status is %s", aws.StringValue(profile.Name), status)
+	case eks.FargateProfileStatusActive:
+		if fargateProfileChanged(profile, response.FargateProfile) {
+			return deleteFargateProfile(svc, model.Name, aws.StringValue(profile.Name))
+		}
+	}
+	return status, nil
+}
+
+func createFargateProfile(svc eksiface.EKSAPI, model *Model, profile FargateProfile) (string, error) {
+	_, err := svc.CreateFargateProfile(&eks.CreateFargateProfileInput{
+		ClusterName:         model.Name,
+		FargateProfileName:  profile.Name,
+		PodExecutionRoleArn: profile.PodExecutionRoleArn,
+		Selectors:           fargateProfileSelectors(profile.Selectors),
+		Subnets:             aws.StringSlice(profile.Subnets),
+		Tags:                tagsToMap(model.Tags),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			if aerr.Code() == eks.ErrCodeResourceInUseException {
+				return eks.FargateProfileStatusCreating, nil
+			}
+		}
+		return "", err
+	}
+	return eks.FargateProfileStatusCreating, nil
+}
+
+// deleteFargateProfile starts deleting a Fargate profile and returns its
+// status, which is empty once the profile no longer exists.
+func deleteFargateProfile(svc eksiface.EKSAPI, clusterName *string, name string) (string, error) {
+	response, err := svc.DescribeFargateProfile(&eks.DescribeFargateProfileInput{
+		ClusterName:        clusterName,
+		FargateProfileName: aws.String(name),
+	})
+	if err != nil {
+		if resourceNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	status := aws.StringValue(response.FargateProfile.Status)
+	if status == eks.FargateProfileStatusDeleting || status == eks.FargateProfileStatusCreating {
+		return status, nil
+	}
+	_, err = svc.DeleteFargateProfile(&eks.DeleteFargateProfileInput{
+		ClusterName:        clusterName,
+		FargateProfileName: aws.String(name),
+	})
+	if err != nil {
+		if resourceNotFound(err) {
+			return "", nil
+		}
+		if aerr, ok := err.(awserr.Error); ok {
+			if aerr.Code() == eks.ErrCodeResourceInUseException {
+				return status, nil
+			}
+		}
+		return "", err
+	}
+	return eks.FargateProfileStatusDeleting, nil
+}
+
+func removedFargateProfiles(prevModel *Model, model *Model) []string {
+	if prevModel == nil {
+		return nil
+	}
+	desired := map[string]bool{}
+	for _, profile := range model.FargateProfiles {
+		desired[aws.StringValue(profile.Name)] = true
+	}
+	removed := []string{}
+	for _, profile := range prevModel.FargateProfiles {
+		if name := aws.StringValue(profile.Name); !desired[name] {
+			removed = append(removed, name)
+		}
+	}
+	return removed
+}
+
+func fargateProfileNames(model *Model) []string {
+	names := make([]string, 0, len(model.FargateProfiles))
+	for _, profile := range model.FargateProfiles {
+		names = append(names, aws.StringValue(profile.Name))
+	}
+	return names
+}
+
+// fargateProfileChanged reports whether the model's definition of a profile
+// differs from the profile EKS reports. Subnets that are not set in the model
+// are left to EKS defaults.
+func fargateProfileChanged(profile FargateProfile, actual *eks.FargateProfile) bool {
+	if aws.StringValue(profile.PodExecutionRoleArn) != aws.StringValue(actual.PodExecutionRoleArn) {
+		return true
+	}
+	if len(profile.Subnets) > 0 && !stringSetsEqual(profile.Subnets, aws.StringValueSlice(actual.Subnets)) {
+		return true
+	}
+	desired := make([]string, 0, len(profile.Selectors))
+	for _, selector := range profile.Selectors {
+		desired = append(desired, selectorKey(aws.StringValue(selector.Namespace), selector.Labels))
+	}
+	current := make([]string, 0, len(actual.Selectors))
+	for _, selector := range actual.Selectors {
+		current = append(current, selectorKey(aws.StringValue(selector.Namespace), aws.StringValueMap(selector.Labels)))
+	}
+	return !stringSetsEqual(desired, current)
+}
+
+// selectorKey renders a selector as a string so selectors can be compared as
+// sets.
+func selectorKey(namespace string, labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return namespace + "/" + strings.Join(pairs, ",")
+}
+
+func fargateProfileSelectors(selectors []FargateProfileSelector) []*eks.FargateProfileSelector {
+	result := make([]*eks.FargateProfileSelector, 0, len(selectors))
+	for _, selector := range selectors {
+		result = append(result, &eks.FargateProfileSelector{
+			Namespace: selector.Namespace,
+			Labels:    aws.StringMap(selector.Labels),
+		})
+	}
+	return result
+}
@@ -0,0 +1,148 @@
+package resource
+
+import (
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type mockFargateClient struct {
+	eksiface.EKSAPI
+	MockProfiles map[string]*eks.FargateProfile
+	CreateInput  *eks.CreateFargateProfileInput
+	Deleted      []string
+}
+
+func (m *mockFargateClient) DescribeFargateProfile(input *eks.DescribeFargateProfileInput) (*eks.DescribeFargateProfileOutput, error) {
+	profile, ok := m.MockProfiles[*input.FargateProfileName]
+	if !ok {
+		return nil, makeAwsError(eks.ErrCodeResourceNotFoundException)
+	}
+	return &eks.DescribeFargateProfileOutput{FargateProfile: profile}, nil
+}
+
+func (m *mockFargateClient) CreateFargateProfile(input *eks.CreateFargateProfileInput) (*eks.CreateFargateProfileOutput, error) {
+	m.CreateInput = input
+	m.MockProfiles[*input.FargateProfileName] = &eks.FargateProfile{
+		FargateProfileName:  input.FargateProfileName,
+		PodExecutionRoleArn: input.PodExecutionRoleArn,
+		Selectors:           input.Selectors,
+		Subnets:             input.Subnets,
+		Status:              aws.String(eks.FargateProfileStatusCreating),
+	}
+	return &eks.CreateFargateProfileOutput{}, nil
+}
+
+func (m *mockFargateClient) DeleteFargateProfile(input *eks.DeleteFargateProfileInput) (*eks.DeleteFargateProfileOutput, error) {
+	m.Deleted = append(m.Deleted, *input.FargateProfileName)
+	m.MockProfiles[*input.FargateProfileName].Status = aws.String(eks.FargateProfileStatusDeleting)
+	return &eks.DeleteFargateProfileOutput{}, nil
+}
+
+func makeFargateProfile(name string) FargateProfile {
+	return FargateProfile{
+		Name:                aws.String(name),
+		PodExecutionRoleArn: aws.String("pod-role"),
+		Selectors: []FargateProfileSelector{
+			{Namespace: aws.String("default")},
+			{Namespace: aws.String("apps"), Labels: map[string]string{"compute": "fargate"}},
+		},
+	}
+}
+
+func makeEksFargateProfile(name string) *eks.FargateProfile {
+	return &eks.FargateProfile{
+		FargateProfileName:  aws.String(name),
+		PodExecutionRoleArn: aws.String("pod-role"),
+		Selectors: []*eks.FargateProfileSelector{
+			{Namespace: aws.String("apps"), Labels: aws.StringMap(map[string]string{"compute": "fargate"})},
+			{Namespace: aws.String("default")},
+		},
+		Subnets: aws.StringSlice([]string{"subnet-private"}),
+		Status:  aws.String(eks.FargateProfileStatusActive),
+	}
+}
+
+func TestReconcileFargateProfiles(t *testing.T) {
+	t.Run("create one at a time", func(t *testing.T) {
+		mockSvc := &mockFargateClient{MockProfiles: map[string]*eks.FargateProfile{}}
+		model := makeModel()
+		model.FargateProfiles = []FargateProfile{makeFargateProfile("one"), makeFargateProfile("two")}
+		progress := reconcileFargateProfiles(mockSvc, nil, model)
+		assert.Equal(t, handler.InProgress, progress.OperationStatus)
+		assert.Equal(t, "Fargate profile one CREATING", progress.Message)
+		assert.Equal(t, "one", progress.CallbackContext["FargateProfile"])
+		assert.Len(t, mockSvc.CreateInput.Selectors, 2)
+		progress = reconcileFargateProfiles(mockSvc, nil, model)
+		assert.Equal(t, "Fargate profile one CREATING", progress.Message)
+		assert.NotContains(t, mockSvc.MockProfiles, "two")
+		mockSvc.MockProfiles["one"].Status = aws.String(eks.FargateProfileStatusActive)
+		progress = reconcileFargateProfiles(mockSvc, nil, model)
+		assert.Equal(t, "Fargate profile two CREATING", progress.Message)
+		mockSvc.MockProfiles["two"].Status = aws.String(eks.FargateProfileStatusActive)
+		progress = reconcileFargateProfiles(mockSvc, nil, model)
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+	})
+	t.Run("replace changed selectors", func(t *testing.T) {
+		mockSvc := &mockFargateClient{MockProfiles: map[string]*eks.FargateProfile{"one": makeEksFargateProfile("one")}}
+		model := makeModel()
+		profile := makeFargateProfile("one")
+		profile.Selectors = profile.Selectors[:1]
+		model.FargateProfiles = []FargateProfile{profile}
+		progress := reconcileFargateProfiles(mockSvc, nil, model)
+		assert.Equal(t, "Fargate profile one DELETING", progress.Message)
+		assert.Equal(t, []string{"one"}, mockSvc.Deleted)
+		delete(mockSvc.MockProfiles, "one")
+		progress = reconcileFargateProfiles(mockSvc, nil, model)
+		assert.Equal(t, "Fargate profile one CREATING", progress.Message)
+		assert.Len(t, mockSvc.CreateInput.Selectors, 1)
+	})
+	t.Run("unchanged", func(t *testing.T) {
+		mockSvc := &mockFargateClient{MockProfiles: map[string]*eks.FargateProfile{"one": makeEksFargateProfile("one")}}
+		model := makeModel()
+		model.FargateProfiles = []FargateProfile{makeFargateProfile("one")}
+		progress := reconcileFargateProfiles(mockSvc, nil, model)
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+		assert.Empty(t, mockSvc.Deleted)
+	})
+	t.Run("removed before created", func(t *testing.T) {
+		mockSvc := &mockFargateClient{MockProfiles: map[string]*eks.FargateProfile{"old": makeEksFargateProfile("old")}}
+		prevModel := makeModel()
+		prevModel.FargateProfiles = []FargateProfile{makeFargateProfile("old")}
+		model := makeModel()
+		model.FargateProfiles = []FargateProfile{makeFargateProfile("new")}
+		progress := reconcileFargateProfiles(mockSvc, prevModel, model)
+		assert.Equal(t, "Fargate profile old DELETING", progress.Message)
+		assert.Nil(t, mockSvc.CreateInput)
+	})
+	t.Run("create failed", func(t *testing.T) {
+		failed := makeEksFargateProfile("one")
+		failed.Status = aws.String(eks.FargateProfileStatusCreateFailed)
+		mockSvc := &mockFargateClient{MockProfiles: map[string]*eks.FargateProfile{"one": failed}}
+		model := makeModel()
+		model.FargateProfiles = []FargateProfile{makeFargateProfile("one")}
+		progress := reconcileFargateProfiles(mockSvc, nil, model)
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
+		assert.Equal(t, "Fargate profile one status is CREATE_FAILED", progress.Message)
+	})
+}
+
+func TestDeleteFargateProfiles(t *testing.T) {
+	mockSvc := &mockFargateClient{MockProfiles: map[string]*eks.FargateProfile{
+		"one": makeEksFargateProfile("one"),
+		"two": makeEksFargateProfile("two"),
+	}}
+	model := makeModel()
+	progress := deleteFargateProfiles(mockSvc, model, []string{"one", "two"})
+	assert.Equal(t, "Fargate profile one DELETING", progress.Message)
+	assert.Equal(t, []string{"one"}, mockSvc.Deleted)
+	delete(mockSvc.MockProfiles, "one")
+	progress = deleteFargateProfiles(mockSvc, model, []string{"one", "two"})
+	assert.Equal(t, "Fargate profile two DELETING", progress.Message)
+	delete(mockSvc.MockProfiles, "two")
+	progress = deleteFargateProfiles(mockSvc, model, []string{"one", "two"})
+	assert.Equal(t, handler.Success, progress.OperationStatus)
+}
@@ -0,0 +1,310 @@
+package resource
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// kubernetesTokenPrefix and clusterIDHeader make up the bearer token
+	// format the EKS authenticator accepts: a presigned STS
+	// GetCallerIdentity request that names the cluster.
+	kubernetesTokenPrefix = "k8s-aws-v1."
+	clusterIDHeader       = "x-k8s-aws-id"
+	kubernetesTokenExpiry = 60 * time.Second
+	kubernetesTimeout     = 20 * time.Second
+	// fieldManager is the owner server-side apply records for the fields
+	// set from the resource's manifests.
+	fieldManager   = "cloudformation-eks-cluster"
+	applyPatchType = "application/apply-patch+yaml"
+)
+
+// kubernetesAPI is the part of the Kubernetes API used by the handlers.
+type kubernetesAPI interface {
+	GetConfigMap(namespace string, name string) (*configMap, error)
+	CreateConfigMap(configMap *configMap) error
+	UpdateConfigMap(configMap *configMap) error
+	ApplyObject(object *manifestObject) error
+	DeleteObject(object *manifestObject) error
+}
+
+type objectMeta struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type configMap struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   objectMeta        `json:"metadata"`
+	Data       map[string]string `json:"data,omitempty"`
+}
+
+func newConfigMap(namespace string, name string) *configMap {
+	return &configMap{
+		APIVersion: "v1",
+		Kind:       "ConfigMap",
+		Metadata:   objectMeta{Name: name, Namespace: namespace},
+		Data:       map[string]string{},
+	}
+}
+
+// kubernetesClient calls the API server of an EKS cluster, authenticating as
+// the handler's own IAM identity.
+type kubernetesClient struct {
+	endpoint  string
+	token     string
+	client    *http.Client
+	resources map[string][]apiResource
+}
+
+// apiResource describes a kind of object served by an API group version.
+type apiResource struct {
+	Name       string `json:"name"`
+	Kind       string `json:"kind"`
+	Namespaced bool   `json:"namespaced"`
+}
+
+// kubernetesConnector returns a function that connects to the Kubernetes API
+// of the cluster described by a model, using svc to sign the token.
+func kubernetesConnector(svc stsiface.STSAPI) func(*Model) (kubernetesAPI, error) {
+	return func(model *Model) (kubernetesAPI, error) {
+		return newKubernetesClient(svc, model)
+	}
+}
+
+func newKubernetesClient(svc stsiface.STSAPI, model *Model) (*kubernetesClient, error) {
+	if model.Endpoint == nil || model.CertificateAuthorityData == nil {
+		return nil, errors.New("cluster has no Kubernetes endpoint yet")
+	}
+	ca, err := base64.StdEncoding.DecodeString(*model.CertificateAuthorityData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cluster certificate authority: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("invalid cluster certificate authority: no certificates found")
+	}
+	token, err := kubernetesToken(svc, aws.StringValue(model.Name))
+	if err != nil {
+		return nil, err
+	}
+	return &kubernetesClient{
+		endpoint: *model.Endpoint,
+		token:    token,
+		client: &http.Client{
+			Timeout:   kubernetesTimeout,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+		resources: map[string][]apiResource{},
+	}, nil
+}
+
+// kubernetesToken presigns a GetCallerIdentity request for clusterName, which
+// the cluster's authenticator exchanges for the caller's IAM identity.
+func kubernetesToken(svc stsiface.STSAPI, clusterName string) (string, error) {
+	request, _ := svc.GetCallerIdentityRequest(&sts.GetCallerIdentityInput{})
+	request.HTTPRequest.Header.Add(clusterIDHeader, clusterName)
+	presigned, err := request.Presign(kubernetesTokenExpiry)
+	if err != nil {
+		return "", err
+	}
+	return kubernetesTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(presigned)), nil
+}
+
+func (c *kubernetesClient) GetConfigMap(namespace string, name string) (*configMap, error) {
+	result := &configMap{}
+	if err := c.doJSON(http.MethodGet, configMapPath(namespace, name), nil, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *kubernetesClient) CreateConfigMap(configMap *configMap) error {
+	return c.doJSON(http.MethodPost, configMapPath(configMap.Metadata.Namespace, ""), configMap, nil)
+}
+
+// UpdateConfigMap replaces a config map. Kubernetes rejects the update with a
+// conflict if the map has changed since the resource version it carries.
+func (c *kubernetesClient) UpdateConfigMap(configMap *configMap) error {
+	return c.doJSON(http.MethodPut, configMapPath(configMap.Metadata.Namespace, configMap.Metadata.Name), configMap, nil)
+}
+
+// ApplyObject creates or updates an object with server-side apply, taking
+// over any fields another manager set that the object also sets.
+func (c *kubernetesClient) ApplyObject(object *manifestObject) error {
+	path, err := c.objectPath(object)
+	if err != nil {
+		return err
+	}
+	query := url.Values{"fieldManager": {fieldManager}, "force": {"true"}}
+	return c.do(http.MethodPatch, path+"?"+query.Encode(), applyPatchType, object.Content, nil)
+}
+
+// DeleteObject deletes an object and, in the background, its dependents.
+// An object that does not exist is already deleted.
+func (c *kubernetesClient) DeleteObject(object *manifestObject) error {
+	path, err := c.objectPath(object)
+	if err != nil {
+		return err
+	}
+	err = c.do(http.MethodDelete, path+"?propagationPolicy=Background", "", nil, nil)
+	if kubernetesNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// objectPath returns the API path of an object, looking up the resource
+// that serves its kind in the discovery document of its group version.
+func (c *kubernetesClient) objectPath(object *manifestObject) (string, error) {
+	base := "/apis/" + object.APIVersion
+	if !strings.Contains(object.APIVersion, "/") {
+		base = "/api/" + object.APIVersion
+	}
+	resources, ok := c.resources[object.APIVersion]
+	if !ok {
+		list := struct {
+			Resources []apiResource `json:"resources"`
+		}{}
+		if err := c.doJSON(http.MethodGet, base, nil, &list); err != nil {
+			return "", err
+		}
+		resources = list.Resources
+		c.resources[object.APIVersion] = resources
+	}
+	for _, resource := range resources {
+		if resource.Kind != object.Kind || strings.Contains(resource.Name, "/") {
+			continue
+		}
+		if !resource.Namespaced {
+			return base + "/" + resource.Name + "/" + object.Name, nil
+		}
+		namespace := object.Namespace
+		if namespace == "" {
+			namespace = defaultNamespace
+		}
+		return base + "/namespaces/" + namespace + "/" + resource.Name + "/" + object.Name, nil
+	}
+	return "", invalidRequestError(fmt.Sprintf("the cluster does not serve kind %s in %s", object.Kind, object.APIVersion))
+}
+
+func configMapPath(namespace string, name string) string {
+	path := "/api/v1/namespaces/" + namespace + "/configmaps"
+	if name != "" {
+		path += "/" + name
+	}
+	return path
+}
+
+// doJSON calls the API with in, if any, encoded as JSON.
+func (c *kubernetesClient) doJSON(method string, path string, in interface{}, out interface{}) error {
+	if in == nil {
+		return c.do(method, path, "", nil, out)
+	}
+	content, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return c.do(method, path, "application/json", content, out)
+}
+
+func (c *kubernetesClient) do(method string, path string, contentType string, content []byte, out interface{}) error {
+	var body io.Reader
+	if content != nil {
+		body = bytes.NewReader(content)
+	}
+	request, err := http.NewRequest(method, c.endpoint+path, body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+c.token)
+	request.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	connected := false
+	request = request.WithContext(httptrace.WithClientTrace(request.Context(), &httptrace.ClientTrace{
+		GotConn: func(httptrace.GotConnInfo) { connected = true },
+	}))
+	response, err := c.client.Do(request)
+	if err != nil && !connected {
+		// Without a connection the endpoint is most likely closed to the
+		// handler by the cluster's endpoint access, which retrying won't fix.
+		return &handlerError{
+			code:    cloudformation.HandlerErrorCodeGeneralServiceException,
+			message: fmt.Sprintf("the cluster's Kubernetes API endpoint is unreachable; EndpointPublicAccess and PublicAccessCidrs must allow the handler to connect: %s", err),
+		}
+	}
+	if err != nil {
+		return &handlerError{code: cloudformation.HandlerErrorCodeNetworkFailure, message: err.Error()}
+	}
+	defer response.Body.Close()
+	result, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return &handlerError{code: cloudformation.HandlerErrorCodeNetworkFailure, message: err.Error()}
+	}
+	if response.StatusCode >= 300 {
+		return kubernetesError(method, strings.SplitN(path, "?", 2)[0], response.StatusCode, result)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(result, out)
+}
+
+// kubernetesStatusCodes maps the HTTP status of a failed Kubernetes API call
+// to the CloudFormation handler error code it should be reported with.
+var kubernetesStatusCodes = map[int]string{
+	http.StatusBadRequest:          cloudformation.HandlerErrorCodeInvalidRequest,
+	http.StatusUnauthorized:        cloudformation.HandlerErrorCodeAccessDenied,
+	http.StatusForbidden:           cloudformation.HandlerErrorCodeAccessDenied,
+	http.StatusNotFound:            cloudformation.HandlerErrorCodeNotFound,
+	http.StatusConflict:            cloudformation.HandlerErrorCodeResourceConflict,
+	http.StatusUnprocessableEntity: cloudformation.HandlerErrorCodeInvalidRequest,
+	http.StatusTooManyRequests:     cloudformation.HandlerErrorCodeThrottling,
+}
+
+// kubernetesError describes a failed Kubernetes API call, using the message
+// of the Status object the API server returns where there is one.
+func kubernetesError(method string, path string, statusCode int, content []byte) error {
+	status := struct {
+		Message string `json:"message"`
+	}{}
+	message := http.StatusText(statusCode)
+	if json.Unmarshal(content, &status) == nil && status.Message != "" {
+		message = status.Message
+	}
+	code, ok := kubernetesStatusCodes[statusCode]
+	if !ok {
+		code = cloudformation.HandlerErrorCodeGeneralServiceException
+		if statusCode >= 500 {
+			code = cloudformation.HandlerErrorCodeServiceInternalError
+		}
+	}
+	return &handlerError{code: code, message: fmt.Sprintf("kubernetes %s %s: %d %s", method, path, statusCode, message)}
+}
+
+// kubernetesNotFound reports whether err is a Kubernetes API call that failed
+// because the object does not exist.
+func kubernetesNotFound(err error) bool {
+	herr, ok := err.(*handlerError)
+	return ok && herr.code == cloudformation.HandlerErrorCodeNotFound
+}
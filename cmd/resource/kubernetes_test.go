@@ -0,0 +1,152 @@
+package resource
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func makeSTSClient() *sts.STS {
+	return sts.New(session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-2"),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+	})))
+}
+
+func TestKubernetesToken(t *testing.T) {
+	token, err := kubernetesToken(makeSTSClient(), "test")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(token, kubernetesTokenPrefix))
+	presigned, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, kubernetesTokenPrefix))
+	assert.Nil(t, err)
+	signed, err := url.Parse(string(presigned))
+	assert.Nil(t, err)
+	assert.Equal(t, "GetCallerIdentity", signed.Query().Get("Action"))
+	assert.Equal(t, "60", signed.Query().Get("X-Amz-Expires"))
+	assert.Contains(t, signed.Query().Get("X-Amz-SignedHeaders"), clusterIDHeader)
+}
+
+func TestKubernetesClient(t *testing.T) {
+	var received *http.Request
+	var body configMap
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		switch r.Method {
+		case http.MethodGet:
+			if strings.HasSuffix(r.URL.Path, "/missing") {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"kind":"Status","message":"configmaps \"missing\" not found"}`))
+				return
+			}
+			json.NewEncoder(w).Encode(makeAuthConfigMap(map[string]string{"mapRoles": nodeRoleEntry}))
+		case http.MethodPut:
+			json.NewDecoder(r.Body).Decode(&body)
+			w.WriteHeader(http.StatusConflict)
+		}
+	}))
+	defer server.Close()
+
+	model := makeModel()
+	model.Endpoint = aws.String(server.URL)
+	model.CertificateAuthorityData = aws.String(base64.StdEncoding.EncodeToString(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})))
+	kube, err := newKubernetesClient(makeSTSClient(), model)
+	assert.Nil(t, err)
+
+	authMap, err := kube.GetConfigMap("kube-system", "aws-auth")
+	assert.Nil(t, err)
+	assert.Equal(t, nodeRoleEntry, authMap.Data["mapRoles"])
+	assert.Equal(t, "/api/v1/namespaces/kube-system/configmaps/aws-auth", received.URL.Path)
+	assert.True(t, strings.HasPrefix(received.Header.Get("Authorization"), "Bearer "+kubernetesTokenPrefix))
+
+	_, err = kube.GetConfigMap("kube-system", "missing")
+	assert.True(t, kubernetesNotFound(err))
+	assert.Equal(t, "kubernetes GET /api/v1/namespaces/kube-system/configmaps/missing: 404 configmaps \"missing\" not found", err.Error())
+
+	err = kube.UpdateConfigMap(authMap)
+	assert.Equal(t, cloudformation.HandlerErrorCodeResourceConflict, handlerErrorCode(err))
+	assert.Equal(t, "1", body.Metadata.ResourceVersion)
+	assert.Equal(t, "application/json", received.Header.Get("Content-Type"))
+}
+
+func TestNewKubernetesClientErrors(t *testing.T) {
+	model := makeModel()
+	_, err := newKubernetesClient(makeSTSClient(), model)
+	assert.NotNil(t, err)
+	model.Endpoint = aws.String("https://endpoint")
+	model.CertificateAuthorityData = aws.String(base64.StdEncoding.EncodeToString([]byte("not a certificate")))
+	_, err = newKubernetesClient(makeSTSClient(), model)
+	assert.NotNil(t, err)
+}
+
+func TestKubernetesClientUnreachable(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	model := makeModel()
+	model.Endpoint = aws.String(server.URL)
+	model.CertificateAuthorityData = aws.String(base64.StdEncoding.EncodeToString(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})))
+	server.Close()
+	kube, err := newKubernetesClient(makeSTSClient(), model)
+	assert.Nil(t, err)
+
+	_, err = kube.GetConfigMap("kube-system", "aws-auth")
+	assert.Equal(t, cloudformation.HandlerErrorCodeGeneralServiceException, handlerErrorCode(err))
+	assert.Contains(t, err.Error(), "unreachable")
+}
+
+func TestKubernetesClientObjects(t *testing.T) {
+	requests := []string{}
+	var applied string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.String())
+		switch {
+		case r.URL.Path == "/api/v1":
+			w.Write([]byte(`{"resources":[{"name":"namespaces","kind":"Namespace","namespaced":false},{"name":"configmaps","kind":"ConfigMap","namespaced":true}]}`))
+		case r.URL.Path == "/apis/storage.k8s.io/v1":
+			w.Write([]byte(`{"resources":[{"name":"storageclasses","kind":"StorageClass","namespaced":false}]}`))
+		case r.Method == http.MethodPatch:
+			assert.Equal(t, applyPatchType, r.Header.Get("Content-Type"))
+			content, _ := ioutil.ReadAll(r.Body)
+			applied = string(content)
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	model := makeModel()
+	model.Endpoint = aws.String(server.URL)
+	model.CertificateAuthorityData = aws.String(base64.StdEncoding.EncodeToString(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})))
+	kube, err := newKubernetesClient(makeSTSClient(), model)
+	assert.Nil(t, err)
+
+	namespace := &manifestObject{APIVersion: "v1", Kind: "Namespace", Name: "team-a", Content: []byte("kind: Namespace\n")}
+	settings := &manifestObject{APIVersion: "v1", Kind: "ConfigMap", Name: "settings"}
+	storageClass := &manifestObject{APIVersion: "storage.k8s.io/v1", Kind: "StorageClass", Name: "gp3"}
+	assert.Nil(t, kube.ApplyObject(namespace))
+	assert.Equal(t, "kind: Namespace\n", applied)
+	assert.Nil(t, kube.ApplyObject(settings))
+	assert.Nil(t, kube.DeleteObject(storageClass))
+	assert.Equal(t, []string{
+		"GET /api/v1",
+		"PATCH /api/v1/namespaces/team-a?fieldManager=cloudformation-eks-cluster&force=true",
+		"PATCH /api/v1/namespaces/default/configmaps/settings?fieldManager=cloudformation-eks-cluster&force=true",
+		"GET /apis/storage.k8s.io/v1",
+		"DELETE /apis/storage.k8s.io/v1/storageclasses/gp3?propagationPolicy=Background",
+	}, requests)
+
+	err = kube.ApplyObject(&manifestObject{APIVersion: "v1", Kind: "Widget", Name: "w"})
+	assert.Equal(t, "the cluster does not serve kind Widget in v1", err.Error())
+}
@@ -0,0 +1,266 @@
+package resource
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultNamespace = "default"
+	s3URIPrefix      = "s3://"
+	// manifestBudget is how long an invocation spends applying or deleting
+	// manifest objects before leaving the rest to the next invocation.
+	manifestBudget = 30 * time.Second
+)
+
+// manifestObject is a Kubernetes object from one of the model's manifests.
+type manifestObject struct {
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+	Content    []byte
+}
+
+// key identifies the object across invocations and manifest versions. The
+// API version is left out, since the same object is served by every version
+// of its group, and a missing namespace is the default one, which Kubernetes
+// puts a namespaced object in.
+func (o *manifestObject) key() string {
+	kind := o.Kind
+	if index := strings.LastIndex(o.APIVersion, "/"); index >= 0 {
+		kind += "." + o.APIVersion[:index]
+	}
+	namespace := o.Namespace
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+	return kind + "/" + namespace + "/" + o.Name
+}
+
+// reconcileManifests applies the objects in the model's manifests, in order,
+// then deletes the objects of the previous model's manifests that are no
+// longer in them, in reverse order. Objects already handled by an earlier
+// invocation of the operation are recorded in the callback context and
+// skipped.
+func reconcileManifests(svc eksiface.EKSAPI, s3Svc s3iface.S3API, prevModel *Model, model *Model, state *callbackState, connect func(*Model) (kubernetesAPI, error), deadline time.Time) handler.ProgressEvent {
+	if len(model.Manifests) == 0 && (prevModel == nil || len(prevModel.Manifests) == 0) {
+		return successEvent(model)
+	}
+	objects, err := loadManifests(s3Svc, model.Manifests)
+	if err != nil {
+		return errorEvent(model, err)
+	}
+	removed := []*manifestObject{}
+	if prevModel != nil {
+		prevObjects, err := loadManifests(s3Svc, prevModel.Manifests)
+		if err != nil {
+			return errorEvent(model, err)
+		}
+		removed = removedManifestObjects(prevObjects, objects)
+	}
+	if model.Endpoint == nil || model.CertificateAuthorityData == nil {
+		if progress := describeCluster(svc, model); progress.OperationStatus != handler.Success {
+			return progress
+		}
+	}
+	kube, err := connect(model)
+	if err != nil {
+		return errorEvent(model, err)
+	}
+	return syncManifestObjects(kube, model, objects, removed, state, deadline)
+}
+
+// deleteManifests deletes the objects in the model's manifests in reverse
+// order, so that anything they provisioned outside the cluster, such as
+// load balancers, is released before the cluster is deleted.
+func deleteManifests(svc eksiface.EKSAPI, s3Svc s3iface.S3API, model *Model, state *callbackState, connect func(*Model) (kubernetesAPI, error), deadline time.Time) handler.ProgressEvent {
+	if len(model.Manifests) == 0 {
+		return successEvent(model)
+	}
+	objects, err := loadManifests(s3Svc, model.Manifests)
+	if err != nil {
+		return errorEvent(model, err)
+	}
+	response, err := svc.DescribeCluster(&eks.DescribeClusterInput{Name: model.Name})
+	if err != nil {
+		if resourceNotFound(err) {
+			return successEvent(model)
+		}
+		return errorEvent(model, err)
+	}
+	describeClusterToModel(*response.Cluster, model)
+	kube, err := connect(model)
+	if err != nil {
+		return errorEvent(model, err)
+	}
+	return syncManifestObjects(kube, model, nil, objects, state, deadline)
+}
+
+// syncManifestObjects applies apply and then deletes remove in reverse
+// order, handing over to another invocation once the deadline has passed.
+func syncManifestObjects(kube kubernetesAPI, model *Model, apply []*manifestObject, remove []*manifestObject, state *callbackState, deadline time.Time) handler.ProgressEvent {
+	done := []string{}
+	if state != nil && state.Phase == phaseManifests {
+		done = append(done, state.ManifestObjects...)
+	}
+	type manifestStep struct {
+		object *manifestObject
+		action func(*manifestObject) error
+	}
+	steps := []manifestStep{}
+	for _, object := range apply {
+		steps = append(steps, manifestStep{object, kube.ApplyObject})
+	}
+	for i := len(remove) - 1; i >= 0; i-- {
+		steps = append(steps, manifestStep{remove[i], kube.DeleteObject})
+	}
+	for _, step := range steps {
+		key := step.object.key()
+		if containsString(done, key) {
+			continue
+		}
+		if time.Now().After(deadline) {
+			return manifestInProgressEvent(model, fmt.Sprintf("%d of %d manifest objects done", len(done), len(steps)), done)
+		}
+		if err := step.action(step.object); err != nil {
+			return errorEvent(model, describeError("manifest object "+key, err))
+		}
+		done = append(done, key)
+	}
+	return successEvent(model)
+}
+
+// removedManifestObjects returns the objects in prev that are not in objects.
+func removedManifestObjects(prev []*manifestObject, objects []*manifestObject) []*manifestObject {
+	keys := map[string]bool{}
+	for _, object := range objects {
+		keys[object.key()] = true
+	}
+	removed := []*manifestObject{}
+	for _, object := range prev {
+		if !keys[object.key()] {
+			removed = append(removed, object)
+		}
+	}
+	return removed
+}
+
+// loadManifests reads the objects from each manifest, which is either
+// inline YAML or an s3:// URI of a YAML document. An S3 URI may name an
+// object version with a versionId query parameter.
+func loadManifests(svc s3iface.S3API, manifests []string) ([]*manifestObject, error) {
+	objects := []*manifestObject{}
+	for i, manifest := range manifests {
+		source := fmt.Sprintf("Manifests[%d]", i)
+		content := []byte(manifest)
+		if isS3URI(manifest) {
+			source = manifest
+			fetched, err := fetchS3Manifest(svc, manifest)
+			if err != nil {
+				return nil, err
+			}
+			content = fetched
+		}
+		parsed, err := parseManifest(source, content)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, parsed...)
+	}
+	return objects, nil
+}
+
+func isS3URI(manifest string) bool {
+	return strings.HasPrefix(strings.TrimSpace(manifest), s3URIPrefix)
+}
+
+func parseS3URI(uri string) (*s3.GetObjectInput, error) {
+	parsed, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil || parsed.Host == "" || strings.Trim(parsed.Path, "/") == "" {
+		return nil, invalidRequestError(fmt.Sprintf("invalid S3 manifest URI %q", uri))
+	}
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(parsed.Host),
+		Key:    aws.String(strings.TrimPrefix(parsed.Path, "/")),
+	}
+	if version := parsed.Query().Get("versionId"); version != "" {
+		input.VersionId = aws.String(version)
+	}
+	return input, nil
+}
+
+func fetchS3Manifest(svc s3iface.S3API, uri string) ([]byte, error) {
+	input, err := parseS3URI(uri)
+	if err != nil {
+		return nil, err
+	}
+	response, err := svc.GetObject(input)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	return ioutil.ReadAll(response.Body)
+}
+
+// parseManifest splits a YAML stream into its objects. Empty documents are
+// skipped; every other document must name its apiVersion, kind and name.
+func parseManifest(source string, content []byte) ([]*manifestObject, error) {
+	objects := []*manifestObject{}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for document := 1; ; document++ {
+		var values yaml.MapSlice
+		err := decoder.Decode(&values)
+		if err == io.EOF {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, invalidRequestError(fmt.Sprintf("%s document %d is not valid YAML: %v", source, document, err))
+		}
+		if len(values) == 0 {
+			continue
+		}
+		metadata, _ := mapSliceValue(values, "metadata").(yaml.MapSlice)
+		object := &manifestObject{
+			APIVersion: mapSliceString(values, "apiVersion"),
+			Kind:       mapSliceString(values, "kind"),
+			Namespace:  mapSliceString(metadata, "namespace"),
+			Name:       mapSliceString(metadata, "name"),
+		}
+		if object.APIVersion == "" || object.Kind == "" || object.Name == "" {
+			return nil, invalidRequestError(fmt.Sprintf("%s document %d must set apiVersion, kind and metadata.name", source, document))
+		}
+		if object.Content, err = yaml.Marshal(values); err != nil {
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+}
+
+func mapSliceValue(values yaml.MapSlice, key string) interface{} {
+	for _, item := range values {
+		if item.Key == key {
+			return item.Value
+		}
+	}
+	return nil
+}
+
+func mapSliceString(values yaml.MapSlice, key string) string {
+	if value := mapSliceValue(values, key); value != nil {
+		return fmt.Sprint(value)
+	}
+	return ""
+}
@@ -0,0 +1,188 @@
+package resource
+
+import (
+	"errors"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+const namespaceManifest = `apiVersion: v1
+kind: Namespace
+metadata:
+  name: team-a
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: reader
+  namespace: team-a
+rules: []
+`
+
+const storageClassManifest = `apiVersion: storage.k8s.io/v1
+kind: StorageClass
+metadata:
+  name: gp3
+provisioner: ebs.csi.aws.com
+`
+
+type mockS3Client struct {
+	s3iface.S3API
+	MockObjects map[string]string
+	GetInput    *s3.GetObjectInput
+}
+
+func (m *mockS3Client) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	m.GetInput = input
+	content, ok := m.MockObjects[*input.Bucket+"/"+*input.Key]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "mock aws error", anErr)
+	}
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(strings.NewReader(content))}, nil
+}
+
+func makeManifestModel() *Model {
+	model := makeAuthModel()
+	model.MapRoles = nil
+	model.Manifests = []string{namespaceManifest, "s3://bucket/storage.yaml"}
+	return model
+}
+
+func makeS3Client() *mockS3Client {
+	return &mockS3Client{MockObjects: map[string]string{"bucket/storage.yaml": storageClassManifest}}
+}
+
+var (
+	namespaceKey    = "Namespace/default/team-a"
+	roleKey         = "Role.rbac.authorization.k8s.io/team-a/reader"
+	storageClassKey = "StorageClass.storage.k8s.io/default/gp3"
+	future          = time.Now().Add(time.Hour)
+)
+
+func TestParseManifest(t *testing.T) {
+	objects, err := parseManifest("Manifests[0]", []byte("---\n"+namespaceManifest+"---\n"))
+	assert.Nil(t, err)
+	assert.Len(t, objects, 2)
+	assert.Equal(t, namespaceKey, objects[0].key())
+	assert.Equal(t, roleKey, objects[1].key())
+	assert.Equal(t, "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: team-a\n", string(objects[0].Content))
+
+	_, err = parseManifest("Manifests[0]", []byte("apiVersion: v1\nkind: Namespace\n"))
+	assert.Equal(t, "Manifests[0] document 1 must set apiVersion, kind and metadata.name", err.Error())
+	_, err = parseManifest("Manifests[1]", []byte("kind: [Namespace"))
+	assert.Contains(t, err.Error(), "Manifests[1] document 1 is not valid YAML")
+}
+
+func TestParseS3URI(t *testing.T) {
+	input, err := parseS3URI("s3://bucket/path/to/manifest.yaml?versionId=v2")
+	assert.Nil(t, err)
+	assert.Equal(t, "bucket", *input.Bucket)
+	assert.Equal(t, "path/to/manifest.yaml", *input.Key)
+	assert.Equal(t, "v2", *input.VersionId)
+	_, err = parseS3URI("s3://bucket/")
+	assert.Equal(t, cloudformation.HandlerErrorCodeInvalidRequest, handlerErrorCode(err))
+}
+
+func TestReconcileManifests(t *testing.T) {
+	t.Run("not configured", func(t *testing.T) {
+		progress := reconcileManifests(&mockEKSClient{}, makeS3Client(), nil, makeModel(), nil, nil, future)
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+	})
+	t.Run("applies in order", func(t *testing.T) {
+		kube := &mockKubernetesClient{}
+		progress := reconcileManifests(&mockEKSClient{}, makeS3Client(), nil, makeManifestModel(), nil, connectTo(kube), future)
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+		assert.Equal(t, []string{namespaceKey, roleKey, storageClassKey}, kube.Applied)
+		assert.Empty(t, kube.Deleted)
+	})
+	t.Run("hands over at the deadline", func(t *testing.T) {
+		kube := &mockKubernetesClient{}
+		progress := reconcileManifests(&mockEKSClient{}, makeS3Client(), nil, makeManifestModel(), nil, connectTo(kube), time.Now().Add(-time.Second))
+		assert.Equal(t, handler.InProgress, progress.OperationStatus)
+		assert.Equal(t, "0 of 3 manifest objects done", progress.Message)
+		assert.Equal(t, phaseManifests, stateOf(t, progress).Phase)
+	})
+	t.Run("resumes", func(t *testing.T) {
+		kube := &mockKubernetesClient{}
+		state := &callbackState{Phase: phaseManifests, ManifestObjects: []string{namespaceKey, roleKey}}
+		progress := reconcileManifests(&mockEKSClient{}, makeS3Client(), nil, makeManifestModel(), state, connectTo(kube), future)
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+		assert.Equal(t, []string{storageClassKey}, kube.Applied)
+	})
+	t.Run("prunes removed objects in reverse order", func(t *testing.T) {
+		kube := &mockKubernetesClient{}
+		model := makeManifestModel()
+		model.Manifests = model.Manifests[1:]
+		progress := reconcileManifests(&mockEKSClient{}, makeS3Client(), makeManifestModel(), model, nil, connectTo(kube), future)
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+		assert.Equal(t, []string{storageClassKey}, kube.Applied)
+		assert.Equal(t, []string{roleKey, namespaceKey}, kube.Deleted)
+	})
+	t.Run("apiVersion change keeps the object", func(t *testing.T) {
+		kube := &mockKubernetesClient{}
+		s3Svc := makeS3Client()
+		model := makeManifestModel()
+		model.Manifests = model.Manifests[1:]
+		prevModel := makeManifestModel()
+		prevModel.Manifests = prevModel.Manifests[1:]
+		s3Svc.MockObjects["bucket/old-storage.yaml"] = strings.Replace(storageClassManifest, "storage.k8s.io/v1", "storage.k8s.io/v1beta1", 1)
+		prevModel.Manifests[0] = "s3://bucket/old-storage.yaml"
+		progress := reconcileManifests(&mockEKSClient{}, s3Svc, prevModel, model, nil, connectTo(kube), future)
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+		assert.Equal(t, []string{storageClassKey}, kube.Applied)
+		assert.Empty(t, kube.Deleted)
+	})
+	t.Run("apply error", func(t *testing.T) {
+		kube := &mockKubernetesClient{MockApplyError: invalidRequestError("the cluster does not serve kind Namespace in v1")}
+		progress := reconcileManifests(&mockEKSClient{}, makeS3Client(), nil, makeManifestModel(), nil, connectTo(kube), future)
+		assert.Equal(t, cloudformation.HandlerErrorCodeInvalidRequest, progress.HandlerErrorCode)
+		assert.Equal(t, "manifest object Namespace/default/team-a: the cluster does not serve kind Namespace in v1", progress.Message)
+	})
+	t.Run("missing S3 manifest", func(t *testing.T) {
+		progress := reconcileManifests(&mockEKSClient{}, &mockS3Client{}, nil, makeManifestModel(), nil, nil, future)
+		assert.Equal(t, cloudformation.HandlerErrorCodeInvalidRequest, progress.HandlerErrorCode)
+	})
+	t.Run("connect error", func(t *testing.T) {
+		progress := reconcileManifests(&mockEKSClient{}, makeS3Client(), nil, makeManifestModel(), nil, func(*Model) (kubernetesAPI, error) {
+			return nil, errors.New("no endpoint")
+		}, future)
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
+	})
+}
+
+func TestDeleteManifests(t *testing.T) {
+	t.Run("deletes in reverse order", func(t *testing.T) {
+		kube := &mockKubernetesClient{}
+		mockSvc := &mockEKSClient{MockCluster: makeCluster()}
+		progress := deleteManifests(mockSvc, makeS3Client(), makeManifestModel(), nil, connectTo(kube), future)
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+		assert.Equal(t, []string{storageClassKey, roleKey, namespaceKey}, kube.Deleted)
+	})
+	t.Run("cluster already deleted", func(t *testing.T) {
+		mockSvc := &mockEKSClient{MockCluster: makeCluster(), MockDescribeError: makeAwsError(eks.ErrCodeResourceNotFoundException)}
+		progress := deleteManifests(mockSvc, makeS3Client(), makeManifestModel(), nil, nil, future)
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+	})
+}
+
+func TestValidateManifests(t *testing.T) {
+	model := makeManifestModel()
+	assert.Empty(t, validateModel(model))
+	model.Manifests = append(model.Manifests, namespaceManifest, "s3://bucket", "kind: Namespace")
+	assert.Len(t, validateModel(model), 4)
+
+	model = makeManifestModel()
+	model.ResourcesVpcConfig.EndpointPublicAccess = aws.Bool(false)
+	model.ResourcesVpcConfig.EndpointPrivateAccess = aws.Bool(true)
+	assert.Equal(t, []string{kubernetesEndpointProblem("Manifests")}, validateModel(model))
+}
@@ -14,14 +14,92 @@ type Model struct {
 	RoleArn                  *string             `json:",omitempty"`
 	Version                  *string             `json:",omitempty"`
 	ResourcesVpcConfig       *ResourcesVpcConfig `json:",omitempty"`
+	Logging                  *Logging            `json:",omitempty"`
+	Tags                     []Tag               `json:",omitempty"`
+	EnableOidcProvider       *bool               `json:",omitempty"`
+	NodeGroups               []NodeGroup         `json:",omitempty"`
+	FargateProfiles          []FargateProfile    `json:",omitempty"`
+	DependencyDeletionPolicy *string             `json:",omitempty"`
+	MapRoles                 []RoleMapping       `json:",omitempty"`
+	MapUsers                 []UserMapping       `json:",omitempty"`
+	MapAccounts              []string            `json:",omitempty"`
+	Manifests                []string            `json:",omitempty"`
 	Arn                      *string             `json:",omitempty"`
 	CertificateAuthorityData *string             `json:",omitempty"`
 	ClusterSecurityGroupId   *string             `json:",omitempty"`
 	Endpoint                 *string             `json:",omitempty"`
+	OpenIdConnectIssuerUrl   *string             `json:",omitempty"`
+	PlatformVersion          *string             `json:",omitempty"`
+	VpcId                    *string             `json:",omitempty"`
+	CreatedAt                *string             `json:",omitempty"`
+	Status                   *string             `json:",omitempty"`
+	OidcProviderArn          *string             `json:",omitempty"`
 }
 
 // ResourcesVpcConfig is autogenerated from the json schema
 type ResourcesVpcConfig struct {
-	SecurityGroupIds []string `json:",omitempty"`
-	SubnetIds        []string `json:",omitempty"`
+	SecurityGroupIds      []string `json:",omitempty"`
+	SubnetIds             []string `json:",omitempty"`
+	EndpointPublicAccess  *bool    `json:",omitempty"`
+	EndpointPrivateAccess *bool    `json:",omitempty"`
+	PublicAccessCidrs     []string `json:",omitempty"`
+}
+
+// Logging is autogenerated from the json schema
+type Logging struct {
+	EnabledTypes []string `json:",omitempty"`
+}
+
+// Tag is autogenerated from the json schema
+type Tag struct {
+	Key   *string `json:",omitempty"`
+	Value *string `json:",omitempty"`
+}
+
+// NodeGroup is autogenerated from the json schema
+type NodeGroup struct {
+	Name           *string           `json:",omitempty"`
+	NodeRole       *string           `json:",omitempty"`
+	InstanceTypes  []string          `json:",omitempty"`
+	ScalingConfig  *ScalingConfig    `json:",omitempty"`
+	Subnets        []string          `json:",omitempty"`
+	Labels         map[string]string `json:",omitempty"`
+	AmiType        *string           `json:",omitempty"`
+	DiskSize       *int              `json:",omitempty"`
+	ReleaseVersion *string           `json:",omitempty"`
+}
+
+// ScalingConfig is autogenerated from the json schema
+type ScalingConfig struct {
+	MinSize     *int `json:",omitempty"`
+	MaxSize     *int `json:",omitempty"`
+	DesiredSize *int `json:",omitempty"`
+}
+
+// FargateProfile is autogenerated from the json schema
+type FargateProfile struct {
+	Name                *string                  `json:",omitempty"`
+	PodExecutionRoleArn *string                  `json:",omitempty"`
+	Subnets             []string                 `json:",omitempty"`
+	Selectors           []FargateProfileSelector `json:",omitempty"`
+}
+
+// FargateProfileSelector is autogenerated from the json schema
+type FargateProfileSelector struct {
+	Namespace *string           `json:",omitempty"`
+	Labels    map[string]string `json:",omitempty"`
+}
+
+// RoleMapping is autogenerated from the json schema
+type RoleMapping struct {
+	RoleArn  *string  `json:",omitempty"`
+	Username *string  `json:",omitempty"`
+	Groups   []string `json:",omitempty"`
+}
+
+// UserMapping is autogenerated from the json schema
+type UserMapping struct {
+	UserArn  *string  `json:",omitempty"`
+	Username *string  `json:",omitempty"`
+	Groups   []string `json:",omitempty"`
 }
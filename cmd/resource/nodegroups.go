@@ -0,0 +1,447 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	"sort"
+	"strings"
+)
+
+// reconcileNodeGroups drives the cluster's managed node groups towards the
+// model: missing node groups are created, changed ones updated, and those
+// removed since the previous model deleted. It is called on every invocation
+// once the cluster is ACTIVE, and reports success when every node group is
+// ACTIVE with no update in flight. Each node group's status and in-flight
+// update are kept in the callback context.
+func reconcileNodeGroups(svc eksiface.EKSAPI, prevModel *Model, model *Model, state *callbackState) handler.ProgressEvent {
+	updates := map[string]string{}
+	if state != nil {
+		for name, updateID := range state.NodeGroupUpdates {
+			updates[name] = updateID
+		}
+	}
+	statuses := map[string]string{}
+	for _, nodeGroup := range model.NodeGroups {
+		name := aws.StringValue(nodeGroup.Name)
+		status, updateID, err := reconcileNodeGroup(svc, model, nodeGroup, updates[name])
+		if err != nil {
+			return errorEvent(model, err)
+		}
+		statuses[name] = status
+		delete(updates, name)
+		if updateID != "" {
+			updates[name] = updateID
+		}
+	}
+	for _, name := range removedNodeGroups(prevModel, model) {
+		status, err := deleteNodeGroup(svc, model.Name, name)
+		if err != nil {
+			return errorEvent(model, err)
+		}
+		if status != "" {
+			statuses[name] = status
+		}
+	}
+	return nodeGroupProgress(model, statuses, updates)
+}
+
+// deleteNodeGroups deletes the named node groups, reporting success once they
+// are all gone.
+func deleteNodeGroups(svc eksiface.EKSAPI, model *Model, names []string) handler.ProgressEvent {
+	statuses := map[string]string{}
+	for _, name := range names {
+		status, err := deleteNodeGroup(svc, model.Name, name)
+		if err != nil {
+			return errorEvent(model, err)
+		}
+		if status != "" {
+			statuses[name] = status
+		}
+	}
+	return nodeGroupProgress(model, statuses, map[string]string{})
+}
+
+func nodeGroupProgress(model *Model, statuses map[string]string, updates map[string]string) handler.ProgressEvent {
+	names := make([]string, 0, len(statuses))
+	for name := range statuses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pending := []string{}
+	for _, name := range names {
+		if statuses[name] != eks.NodegroupStatusActive {
+			pending = append(pending, name+" "+statuses[name])
+		}
+	}
+	if len(pending) == 0 {
+		return successEvent(model)
+	}
+	return nodeGroupInProgressEvent(model, "node group "+strings.Join(pending, ", "), statuses, updates)
+}
+
+// reconcileNodeGroup moves a single node group one step towards the model and
+// returns its status along with the ID of any update in flight.
+func reconcileNodeGroup(svc eksiface.EKSAPI, model *Model, nodeGroup NodeGroup, updateID string) (string, string, error) {
+	response, err := svc.DescribeNodegroup(&eks.DescribeNodegroupInput{
+		ClusterName:   model.Name,
+		NodegroupName: nodeGroup.Name,
+	})
+	if err != nil {
+		if resourceNotFound(err) {
+			return createNodeGroup(svc, model, nodeGroup)
+		}
+		return "", "", err
+	}
+	actual := response.Nodegroup
+	status := aws.StringValue(actual.Status)
+	switch status {
+	case eks.NodegroupStatusCreateFailed, eks.NodegroupStatusDeleteFailed, eks.NodegroupStatusDegraded:
+		return "", "", nodeGroupHealthError(actual)
+	case eks.NodegroupStatusActive:
+	default:
+		return status, updateID, nil
+	}
+	if updateID != "" {
+		response, err := svc.DescribeUpdate(&eks.DescribeUpdateInput{
+			Name:          model.Name,
+			NodegroupName: nodeGroup.Name,
+			UpdateId:      aws.String(updateID),
+		})
+		if err != nil {
+			return "", "", err
+		}
+		switch aws.StringValue(response.Update.Status) {
+		case eks.UpdateStatusSuccessful:
+		case eks.UpdateStatusFailed, eks.UpdateStatusCancelled:
+			return "", "", updateError("node group "+aws.StringValue(nodeGroup.Name), response.Update)
+		default:
+			return eks.NodegroupStatusUpdating, updateID, nil
+		}
+	}
+	if changed := nodeGroupReplacementChanges(nodeGroup, actual); len(changed) > 0 {
+		return "", "", invalidRequestError(fmt.Sprintf(
+			"node group %s: %s cannot be changed in place, give the node group a new name to replace it",
+			aws.StringValue(nodeGroup.Name), strings.Join(changed, ", ")))
+	}
+	if nodeGroupConfigChanged(nodeGroup, actual) {
+		return updateNodeGroupConfig(svc, model, nodeGroup, actual)
+	}
+	if nodeGroupVersionChanged(model, nodeGroup, actual) {
+		return updateNodeGroupVersion(svc, model, nodeGroup, actual)
+	}
+	return status, "", nil
+}
+
+// upgradeNodeGroups moves the named node groups to version, one step per
+// invocation. It returns the status of every node group that is not yet
+// ACTIVE at that version, along with the updates in flight. Node groups that
+// do not exist yet are left to be created at the model's version.
+func upgradeNodeGroups(svc eksiface.EKSAPI, model *Model, names []string, version string, updates map[string]string) (map[string]string, map[string]string, error) {
+	statuses := map[string]string{}
+	inFlight := map[string]string{}
+	for _, name := range names {
+		response, err := svc.DescribeNodegroup(&eks.DescribeNodegroupInput{
+			ClusterName:   model.Name,
+			NodegroupName: aws.String(name),
+		})
+		if err != nil {
+			if resourceNotFound(err) {
+				continue
+			}
+			return nil, nil, err
+		}
+		actual := response.Nodegroup
+		status := aws.StringValue(actual.Status)
+		switch status {
+		case eks.NodegroupStatusCreateFailed, eks.NodegroupStatusDeleteFailed, eks.NodegroupStatusDegraded:
+			return nil, nil, nodeGroupHealthError(actual)
+		case eks.NodegroupStatusActive:
+		default:
+			statuses[name] = status
+			if updateID := updates[name]; updateID != "" {
+				inFlight[name] = updateID
+			}
+			continue
+		}
+		if updateID := updates[name]; updateID != "" {
+			response, err := svc.DescribeUpdate(&eks.DescribeUpdateInput{
+				Name:          model.Name,
+				NodegroupName: aws.String(name),
+				UpdateId:      aws.String(updateID),
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			switch aws.StringValue(response.Update.Status) {
+			case eks.UpdateStatusSuccessful:
+			case eks.UpdateStatusFailed, eks.UpdateStatusCancelled:
+				return nil, nil, updateError("node group "+name, response.Update)
+			default:
+				statuses[name] = eks.NodegroupStatusUpdating
+				inFlight[name] = updateID
+				continue
+			}
+		}
+		if aws.StringValue(actual.Version) == version {
+			continue
+		}
+		update, err := svc.UpdateNodegroupVersion(&eks.UpdateNodegroupVersionInput{
+			ClusterName:   model.Name,
+			NodegroupName: aws.String(name),
+			Version:       aws.String(version),
+		})
+		if err != nil {
+			status, _, err := nodeGroupUpdateError(err)
+			if err != nil {
+				return nil, nil, err
+			}
+			statuses[name] = status
+			continue
+		}
+		statuses[name] = eks.NodegroupStatusUpdating
+		inFlight[name] = aws.StringValue(update.Update.Id)
+	}
+	return statuses, inFlight, nil
+}
+
+func createNodeGroup(svc eksiface.EKSAPI, model *Model, nodeGroup NodeGroup) (string, string, error) {
+	subnets := nodeGroup.Subnets
+	if len(subnets) == 0 && model.ResourcesVpcConfig != nil {
+		subnets = model.ResourcesVpcConfig.SubnetIds
+	}
+	input := &eks.CreateNodegroupInput{
+		ClusterName:    model.Name,
+		NodegroupName:  nodeGroup.Name,
+		NodeRole:       nodeGroup.NodeRole,
+		InstanceTypes:  aws.StringSlice(nodeGroup.InstanceTypes),
+		ScalingConfig:  nodeGroupScalingConfig(nodeGroup.ScalingConfig),
+		Subnets:        aws.StringSlice(subnets),
+		Labels:         aws.StringMap(nodeGroup.Labels),
+		AmiType:        nodeGroup.AmiType,
+		ReleaseVersion: nodeGroup.ReleaseVersion,
+		Version:        model.Version,
+		Tags:           tagsToMap(model.Tags),
+	}
+	if nodeGroup.DiskSize != nil {
+		input.DiskSize = aws.Int64(int64(*nodeGroup.DiskSize))
+	}
+	if _, err := svc.CreateNodegroup(input); err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			if aerr.Code() == eks.ErrCodeResourceInUseException {
+				return eks.NodegroupStatusCreating, "", nil
+			}
+		}
+		return "", "", err
+	}
+	return eks.NodegroupStatusCreating, "", nil
+}
+
+func updateNodeGroupConfig(svc eksiface.EKSAPI, model *Model, nodeGroup NodeGroup, actual *eks.Nodegroup) (string, string, error) {
+	input := &eks.UpdateNodegroupConfigInput{
+		ClusterName:   model.Name,
+		NodegroupName: nodeGroup.Name,
+		ScalingConfig: nodeGroupScalingConfig(nodeGroup.ScalingConfig),
+	}
+	add, remove := labelChanges(aws.StringValueMap(actual.Labels), nodeGroup.Labels)
+	if len(add) > 0 || len(remove) > 0 {
+		input.Labels = &eks.UpdateLabelsPayload{}
+		if len(add) > 0 {
+			input.Labels.AddOrUpdateLabels = aws.StringMap(add)
+		}
+		if len(remove) > 0 {
+			input.Labels.RemoveLabels = aws.StringSlice(remove)
+		}
+	}
+	response, err := svc.UpdateNodegroupConfig(input)
+	if err != nil {
+		return nodeGroupUpdateError(err)
+	}
+	return eks.NodegroupStatusUpdating, aws.StringValue(response.Update.Id), nil
+}
+
+func updateNodeGroupVersion(svc eksiface.EKSAPI, model *Model, nodeGroup NodeGroup, actual *eks.Nodegroup) (string, string, error) {
+	input := &eks.UpdateNodegroupVersionInput{
+		ClusterName:   model.Name,
+		NodegroupName: nodeGroup.Name,
+	}
+	if nodeGroup.ReleaseVersion != nil && aws.StringValue(nodeGroup.ReleaseVersion) != aws.StringValue(actual.ReleaseVersion) {
+		input.ReleaseVersion = nodeGroup.ReleaseVersion
+	} else {
+		input.Version = model.Version
+	}
+	response, err := svc.UpdateNodegroupVersion(input)
+	if err != nil {
+		return nodeGroupUpdateError(err)
+	}
+	return eks.NodegroupStatusUpdating, aws.StringValue(response.Update.Id), nil
+}
+
+// nodeGroupUpdateError treats a node group that is busy with another update as
+// still updating, so the change is retried on the next invocation.
+func nodeGroupUpdateError(err error) (string, string, error) {
+	if aerr, ok := err.(awserr.Error); ok {
+		if aerr.Code() == eks.ErrCodeResourceInUseException {
+			return eks.NodegroupStatusUpdating, "", nil
+		}
+	}
+	return "", "", err
+}
+
+// deleteNodeGroup starts deleting a node group and returns its status, which
+// is empty once the node group no longer exists.
+func deleteNodeGroup(svc eksiface.EKSAPI, clusterName *string, name string) (string, error) {
+	response, err := svc.DescribeNodegroup(&eks.DescribeNodegroupInput{
+		ClusterName:   clusterName,
+		NodegroupName: aws.String(name),
+	})
+	if err != nil {
+		if resourceNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	if status := aws.StringValue(response.Nodegroup.Status); status == eks.NodegroupStatusDeleting {
+		return status, nil
+	}
+	_, err = svc.DeleteNodegroup(&eks.DeleteNodegroupInput{
+		ClusterName:   clusterName,
+		NodegroupName: aws.String(name),
+	})
+	if err != nil {
+		if resourceNotFound(err) {
+			return "", nil
+		}
+		if aerr, ok := err.(awserr.Error); ok {
+			if aerr.Code() == eks.ErrCodeResourceInUseException {
+				return aws.StringValue(response.Nodegroup.Status), nil
+			}
+		}
+		return "", err
+	}
+	return eks.NodegroupStatusDeleting, nil
+}
+
+func removedNodeGroups(prevModel *Model, model *Model) []string {
+	if prevModel == nil {
+		return nil
+	}
+	desired := map[string]bool{}
+	for _, nodeGroup := range model.NodeGroups {
+		desired[aws.StringValue(nodeGroup.Name)] = true
+	}
+	removed := []string{}
+	for _, nodeGroup := range prevModel.NodeGroups {
+		if name := aws.StringValue(nodeGroup.Name); !desired[name] {
+			removed = append(removed, name)
+		}
+	}
+	return removed
+}
+
+func nodeGroupNames(model *Model) []string {
+	names := make([]string, 0, len(model.NodeGroups))
+	for _, nodeGroup := range model.NodeGroups {
+		names = append(names, aws.StringValue(nodeGroup.Name))
+	}
+	return names
+}
+
+// nodeGroupReplacementChanges lists the properties that differ between the
+// model and the node group but cannot be updated in place. Optional
+// properties that are not set in the model are left to EKS defaults.
+func nodeGroupReplacementChanges(nodeGroup NodeGroup, actual *eks.Nodegroup) []string {
+	changed := []string{}
+	if aws.StringValue(nodeGroup.NodeRole) != aws.StringValue(actual.NodeRole) {
+		changed = append(changed, "NodeRole")
+	}
+	if len(nodeGroup.InstanceTypes) > 0 && !stringSetsEqual(nodeGroup.InstanceTypes, aws.StringValueSlice(actual.InstanceTypes)) {
+		changed = append(changed, "InstanceTypes")
+	}
+	if len(nodeGroup.Subnets) > 0 && !stringSetsEqual(nodeGroup.Subnets, aws.StringValueSlice(actual.Subnets)) {
+		changed = append(changed, "Subnets")
+	}
+	if nodeGroup.AmiType != nil && *nodeGroup.AmiType != aws.StringValue(actual.AmiType) {
+		changed = append(changed, "AmiType")
+	}
+	if nodeGroup.DiskSize != nil && int64(*nodeGroup.DiskSize) != aws.Int64Value(actual.DiskSize) {
+		changed = append(changed, "DiskSize")
+	}
+	return changed
+}
+
+func nodeGroupConfigChanged(nodeGroup NodeGroup, actual *eks.Nodegroup) bool {
+	if scaling := nodeGroup.ScalingConfig; scaling != nil && actual.ScalingConfig != nil {
+		if !intEqualsInt64(scaling.MinSize, actual.ScalingConfig.MinSize) ||
+			!intEqualsInt64(scaling.MaxSize, actual.ScalingConfig.MaxSize) ||
+			!intEqualsInt64(scaling.DesiredSize, actual.ScalingConfig.DesiredSize) {
+			return true
+		}
+	}
+	add, remove := labelChanges(aws.StringValueMap(actual.Labels), nodeGroup.Labels)
+	return len(add) > 0 || len(remove) > 0
+}
+
+func nodeGroupVersionChanged(model *Model, nodeGroup NodeGroup, actual *eks.Nodegroup) bool {
+	if nodeGroup.ReleaseVersion != nil && *nodeGroup.ReleaseVersion != aws.StringValue(actual.ReleaseVersion) {
+		return true
+	}
+	return model.Version != nil && *model.Version != aws.StringValue(actual.Version)
+}
+
+// intEqualsInt64 reports whether an optional model value matches the value
+// EKS reports. A value that is not set in the model always matches.
+func intEqualsInt64(desired *int, actual *int64) bool {
+	return desired == nil || int64(*desired) == aws.Int64Value(actual)
+}
+
+func labelChanges(actual map[string]string, desired map[string]string) (map[string]string, []string) {
+	add := map[string]string{}
+	for k, v := range desired {
+		if current, ok := actual[k]; !ok || current != v {
+			add[k] = v
+		}
+	}
+	remove := []string{}
+	for k := range actual {
+		if _, ok := desired[k]; !ok {
+			remove = append(remove, k)
+		}
+	}
+	sort.Strings(remove)
+	return add, remove
+}
+
+func nodeGroupScalingConfig(scaling *ScalingConfig) *eks.NodegroupScalingConfig {
+	if scaling == nil {
+		return nil
+	}
+	config := &eks.NodegroupScalingConfig{}
+	if scaling.MinSize != nil {
+		config.MinSize = aws.Int64(int64(*scaling.MinSize))
+	}
+	if scaling.MaxSize != nil {
+		config.MaxSize = aws.Int64(int64(*scaling.MaxSize))
+	}
+	if scaling.DesiredSize != nil {
+		config.DesiredSize = aws.Int64(int64(*scaling.DesiredSize))
+	}
+	return config
+}
+
+func nodeGroupHealthError(nodeGroup *eks.Nodegroup) error {
+	message := fmt.Sprintf("node group %s status is %s", aws.StringValue(nodeGroup.NodegroupName), aws.StringValue(nodeGroup.Status))
+	if nodeGroup.Health != nil {
+		for _, issue := range nodeGroup.Health.Issues {
+			message += fmt.Sprintf("; %s: %s", aws.StringValue(issue.Code), aws.StringValue(issue.Message))
+			if len(issue.ResourceIds) > 0 {
+				message += " (" + strings.Join(aws.StringValueSlice(issue.ResourceIds), ", ") + ")"
+			}
+		}
+	}
+	return errors.New(message)
+}
@@ -0,0 +1,291 @@
+package resource
+
+import (
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type mockNodeGroupClient struct {
+	eksiface.EKSAPI
+	MockNodeGroups   map[string]*eks.Nodegroup
+	MockUpdateStatus string
+	MockUpdateError  error
+	CreateInput      *eks.CreateNodegroupInput
+	ConfigInput      *eks.UpdateNodegroupConfigInput
+	VersionInput     *eks.UpdateNodegroupVersionInput
+	Deleted          []string
+}
+
+func (m *mockNodeGroupClient) DescribeNodegroup(input *eks.DescribeNodegroupInput) (*eks.DescribeNodegroupOutput, error) {
+	nodeGroup, ok := m.MockNodeGroups[*input.NodegroupName]
+	if !ok {
+		return nil, makeAwsError(eks.ErrCodeResourceNotFoundException)
+	}
+	return &eks.DescribeNodegroupOutput{Nodegroup: nodeGroup}, nil
+}
+
+func (m *mockNodeGroupClient) CreateNodegroup(input *eks.CreateNodegroupInput) (*eks.CreateNodegroupOutput, error) {
+	m.CreateInput = input
+	return &eks.CreateNodegroupOutput{}, nil
+}
+
+func (m *mockNodeGroupClient) UpdateNodegroupConfig(input *eks.UpdateNodegroupConfigInput) (*eks.UpdateNodegroupConfigOutput, error) {
+	m.ConfigInput = input
+	return &eks.UpdateNodegroupConfigOutput{Update: &eks.Update{Id: aws.String("ConfigId")}}, m.MockUpdateError
+}
+
+func (m *mockNodeGroupClient) UpdateNodegroupVersion(input *eks.UpdateNodegroupVersionInput) (*eks.UpdateNodegroupVersionOutput, error) {
+	m.VersionInput = input
+	return &eks.UpdateNodegroupVersionOutput{Update: &eks.Update{Id: aws.String("VersionId")}}, m.MockUpdateError
+}
+
+func (m *mockNodeGroupClient) DescribeUpdate(input *eks.DescribeUpdateInput) (*eks.DescribeUpdateOutput, error) {
+	return &eks.DescribeUpdateOutput{
+		Update: &eks.Update{Id: input.UpdateId, Type: aws.String(eks.UpdateTypeConfigUpdate), Status: aws.String(m.MockUpdateStatus)},
+	}, nil
+}
+
+func (m *mockNodeGroupClient) DeleteNodegroup(input *eks.DeleteNodegroupInput) (*eks.DeleteNodegroupOutput, error) {
+	m.Deleted = append(m.Deleted, *input.NodegroupName)
+	return &eks.DeleteNodegroupOutput{}, nil
+}
+
+func makeNodeGroup(name string) NodeGroup {
+	return NodeGroup{
+		Name:          aws.String(name),
+		NodeRole:      aws.String("node-role"),
+		InstanceTypes: []string{"m5.large"},
+		ScalingConfig: &ScalingConfig{MinSize: aws.Int(1), MaxSize: aws.Int(3), DesiredSize: aws.Int(2)},
+		Labels:        map[string]string{"team": "platform"},
+	}
+}
+
+func makeNodegroup(name string) *eks.Nodegroup {
+	return &eks.Nodegroup{
+		NodegroupName:  aws.String(name),
+		NodeRole:       aws.String("node-role"),
+		InstanceTypes:  aws.StringSlice([]string{"m5.large"}),
+		Subnets:        aws.StringSlice([]string{"subnet-1"}),
+		AmiType:        aws.String(eks.AMITypesAl2X8664),
+		DiskSize:       aws.Int64(20),
+		ScalingConfig:  &eks.NodegroupScalingConfig{MinSize: aws.Int64(1), MaxSize: aws.Int64(3), DesiredSize: aws.Int64(2)},
+		Labels:         aws.StringMap(map[string]string{"team": "platform"}),
+		ReleaseVersion: aws.String("1.14.9-20200228"),
+		Version:        aws.String("1.14"),
+		Status:         aws.String(eks.NodegroupStatusActive),
+	}
+}
+
+func TestReconcileNodeGroups(t *testing.T) {
+	t.Run("create", func(t *testing.T) {
+		mockSvc := &mockNodeGroupClient{MockNodeGroups: map[string]*eks.Nodegroup{}}
+		model := makeModel()
+		model.NodeGroups = []NodeGroup{makeNodeGroup("workers")}
+		progress := reconcileNodeGroups(mockSvc, nil, model, nil)
+		assert.Equal(t, handler.InProgress, progress.OperationStatus)
+		assert.Equal(t, "node group workers CREATING", progress.Message)
+		assert.Equal(t, []*string{aws.String("subnet-1")}, mockSvc.CreateInput.Subnets)
+		assert.Equal(t, aws.String("1.14"), mockSvc.CreateInput.Version)
+	})
+	t.Run("active", func(t *testing.T) {
+		mockSvc := &mockNodeGroupClient{MockNodeGroups: map[string]*eks.Nodegroup{"workers": makeNodegroup("workers")}}
+		model := makeModel()
+		model.NodeGroups = []NodeGroup{makeNodeGroup("workers")}
+		progress := reconcileNodeGroups(mockSvc, nil, model, nil)
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+		assert.Nil(t, mockSvc.ConfigInput)
+		assert.Nil(t, mockSvc.VersionInput)
+	})
+	t.Run("scaling and labels", func(t *testing.T) {
+		mockSvc := &mockNodeGroupClient{MockNodeGroups: map[string]*eks.Nodegroup{"workers": makeNodegroup("workers")}}
+		model := makeModel()
+		nodeGroup := makeNodeGroup("workers")
+		nodeGroup.ScalingConfig.DesiredSize = aws.Int(3)
+		nodeGroup.Labels = map[string]string{"tier": "web"}
+		model.NodeGroups = []NodeGroup{nodeGroup}
+		progress := reconcileNodeGroups(mockSvc, nil, model, nil)
+		assert.Equal(t, handler.InProgress, progress.OperationStatus)
+		assert.Equal(t, map[string]string{"workers": "ConfigId"}, progress.CallbackContext["NodeGroupUpdates"])
+		assert.Equal(t, aws.Int64(3), mockSvc.ConfigInput.ScalingConfig.DesiredSize)
+		assert.Equal(t, aws.StringMap(map[string]string{"tier": "web"}), mockSvc.ConfigInput.Labels.AddOrUpdateLabels)
+		assert.Equal(t, aws.StringSlice([]string{"team"}), mockSvc.ConfigInput.Labels.RemoveLabels)
+	})
+	t.Run("version", func(t *testing.T) {
+		mockSvc := &mockNodeGroupClient{MockNodeGroups: map[string]*eks.Nodegroup{"workers": makeNodegroup("workers")}}
+		model := makeModel()
+		model.Version = aws.String("1.15")
+		model.NodeGroups = []NodeGroup{makeNodeGroup("workers")}
+		progress := reconcileNodeGroups(mockSvc, nil, model, nil)
+		assert.Equal(t, handler.InProgress, progress.OperationStatus)
+		assert.Equal(t, aws.String("1.15"), mockSvc.VersionInput.Version)
+	})
+	t.Run("update in progress", func(t *testing.T) {
+		mockSvc := &mockNodeGroupClient{
+			MockNodeGroups:   map[string]*eks.Nodegroup{"workers": makeNodegroup("workers")},
+			MockUpdateStatus: eks.UpdateStatusInProgress,
+		}
+		model := makeModel()
+		model.NodeGroups = []NodeGroup{makeNodeGroup("workers")}
+		state := &callbackState{Phase: phaseNodeGroups, NodeGroupUpdates: map[string]string{"workers": "ConfigId"}}
+		progress := reconcileNodeGroups(mockSvc, nil, model, state)
+		assert.Equal(t, handler.InProgress, progress.OperationStatus)
+		assert.Equal(t, "node group workers UPDATING", progress.Message)
+		mockSvc.MockUpdateStatus = eks.UpdateStatusSuccessful
+		progress = reconcileNodeGroups(mockSvc, nil, model, stateOf(t, progress))
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+	})
+	t.Run("update failed", func(t *testing.T) {
+		mockSvc := &mockNodeGroupClient{
+			MockNodeGroups:   map[string]*eks.Nodegroup{"workers": makeNodegroup("workers")},
+			MockUpdateStatus: eks.UpdateStatusFailed,
+		}
+		model := makeModel()
+		model.NodeGroups = []NodeGroup{makeNodeGroup("workers")}
+		state := &callbackState{Phase: phaseNodeGroups, NodeGroupUpdates: map[string]string{"workers": "ConfigId"}}
+		progress := reconcileNodeGroups(mockSvc, nil, model, state)
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
+		assert.Contains(t, progress.Message, "node group workers update ConfigId status is Failed")
+	})
+	t.Run("immutable change", func(t *testing.T) {
+		mockSvc := &mockNodeGroupClient{MockNodeGroups: map[string]*eks.Nodegroup{"workers": makeNodegroup("workers")}}
+		model := makeModel()
+		nodeGroup := makeNodeGroup("workers")
+		nodeGroup.InstanceTypes = []string{"m5.xlarge"}
+		nodeGroup.DiskSize = aws.Int(50)
+		model.NodeGroups = []NodeGroup{nodeGroup}
+		progress := reconcileNodeGroups(mockSvc, nil, model, nil)
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
+		assert.Equal(t, cloudformation.HandlerErrorCodeInvalidRequest, progress.HandlerErrorCode)
+		assert.Contains(t, progress.Message, "InstanceTypes, DiskSize")
+	})
+	t.Run("degraded", func(t *testing.T) {
+		degraded := makeNodegroup("workers")
+		degraded.Status = aws.String(eks.NodegroupStatusDegraded)
+		degraded.Health = &eks.NodegroupHealth{Issues: []*eks.Issue{{
+			Code:        aws.String(eks.NodegroupIssueCodeAccessDenied),
+			Message:     aws.String("denied"),
+			ResourceIds: aws.StringSlice([]string{"asg-1"}),
+		}}}
+		mockSvc := &mockNodeGroupClient{MockNodeGroups: map[string]*eks.Nodegroup{"workers": degraded}}
+		model := makeModel()
+		model.NodeGroups = []NodeGroup{makeNodeGroup("workers")}
+		progress := reconcileNodeGroups(mockSvc, nil, model, nil)
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
+		assert.Equal(t, "node group workers status is DEGRADED; AccessDenied: denied (asg-1)", progress.Message)
+	})
+	t.Run("removed", func(t *testing.T) {
+		mockSvc := &mockNodeGroupClient{MockNodeGroups: map[string]*eks.Nodegroup{
+			"workers": makeNodegroup("workers"),
+			"old":     makeNodegroup("old"),
+		}}
+		prevModel := makeModel()
+		prevModel.NodeGroups = []NodeGroup{makeNodeGroup("workers"), makeNodeGroup("old")}
+		model := makeModel()
+		model.NodeGroups = []NodeGroup{makeNodeGroup("workers")}
+		progress := reconcileNodeGroups(mockSvc, prevModel, model, nil)
+		assert.Equal(t, handler.InProgress, progress.OperationStatus)
+		assert.Equal(t, "node group old DELETING", progress.Message)
+		assert.Equal(t, []string{"old"}, mockSvc.Deleted)
+		delete(mockSvc.MockNodeGroups, "old")
+		progress = reconcileNodeGroups(mockSvc, prevModel, model, stateOf(t, progress))
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+	})
+}
+
+func TestDeleteNodeGroups(t *testing.T) {
+	deleting := makeNodegroup("deleting")
+	deleting.Status = aws.String(eks.NodegroupStatusDeleting)
+	mockSvc := &mockNodeGroupClient{MockNodeGroups: map[string]*eks.Nodegroup{
+		"workers":  makeNodegroup("workers"),
+		"deleting": deleting,
+	}}
+	model := makeModel()
+	progress := deleteNodeGroups(mockSvc, model, []string{"workers", "deleting", "gone"})
+	assert.Equal(t, handler.InProgress, progress.OperationStatus)
+	assert.Equal(t, []string{"workers"}, mockSvc.Deleted)
+	assert.Equal(t, map[string]string{"workers": "DELETING", "deleting": "DELETING"}, progress.CallbackContext["NodeGroups"])
+	mockSvc.MockNodeGroups = map[string]*eks.Nodegroup{}
+	progress = deleteNodeGroups(mockSvc, model, []string{"workers", "deleting", "gone"})
+	assert.Equal(t, handler.Success, progress.OperationStatus)
+}
+
+func TestLabelChanges(t *testing.T) {
+	add, remove := labelChanges(
+		map[string]string{"a": "1", "b": "2", "c": "3"},
+		map[string]string{"a": "1", "b": "20", "d": "4"},
+	)
+	assert.Equal(t, map[string]string{"b": "20", "d": "4"}, add)
+	assert.Equal(t, []string{"c"}, remove)
+}
+
+// mockUpgradeClient serves a cluster version update together with the
+// cluster's node groups.
+type mockUpgradeClient struct {
+	mockNodeGroupClient
+	ClusterVersionInput *eks.UpdateClusterVersionInput
+}
+
+func (m *mockUpgradeClient) UpdateClusterVersion(input *eks.UpdateClusterVersionInput) (*eks.UpdateClusterVersionOutput, error) {
+	m.ClusterVersionInput = input
+	return &eks.UpdateClusterVersionOutput{Update: &eks.Update{Id: aws.String("ClusterVersionId")}}, nil
+}
+
+func (m *mockUpgradeClient) DescribeCluster(input *eks.DescribeClusterInput) (*eks.DescribeClusterOutput, error) {
+	cluster := makeCluster()
+	cluster.Version = aws.String("1.16")
+	return &eks.DescribeClusterOutput{Cluster: cluster}, nil
+}
+
+func TestVersionUpdateUpgradesNodeGroupsBetweenHops(t *testing.T) {
+	mockSvc := &mockUpgradeClient{mockNodeGroupClient: mockNodeGroupClient{
+		MockNodeGroups:   map[string]*eks.Nodegroup{"workers": makeNodegroup("workers")},
+		MockUpdateStatus: eks.UpdateStatusSuccessful,
+	}}
+	model := makeModel()
+	model.Version = aws.String("1.16")
+	model.NodeGroups = []NodeGroup{makeNodeGroup("workers")}
+	state := &callbackState{
+		Phase:          phaseWaitingUpdate,
+		OpComplete:     true,
+		UpdateID:       "ClusterVersionId",
+		PendingUpdates: []string{updateStepVersion},
+		VersionPlan:    []string{"1.15", "1.16"},
+		VersionHop:     0,
+	}
+
+	progress := updateCluster(mockSvc, makeModel(), model, state)
+	assert.Equal(t, handler.InProgress, progress.OperationStatus)
+	assert.Nil(t, mockSvc.ClusterVersionInput)
+	assert.Equal(t, "1.15", *mockSvc.VersionInput.Version)
+	state = stateOf(t, progress)
+	assert.Equal(t, phaseUpgradingNodeGroups, state.Phase)
+	assert.Equal(t, map[string]string{"workers": "VersionId"}, state.NodeGroupUpdates)
+
+	mockSvc.MockUpdateStatus = eks.UpdateStatusInProgress
+	mockSvc.MockNodeGroups["workers"].Status = aws.String(eks.NodegroupStatusUpdating)
+	progress = updateCluster(mockSvc, makeModel(), model, state)
+	assert.Equal(t, handler.InProgress, progress.OperationStatus)
+	assert.Nil(t, mockSvc.ClusterVersionInput)
+	state = stateOf(t, progress)
+
+	mockSvc.MockUpdateStatus = eks.UpdateStatusSuccessful
+	mockSvc.MockNodeGroups["workers"].Status = aws.String(eks.NodegroupStatusActive)
+	mockSvc.MockNodeGroups["workers"].Version = aws.String("1.15")
+	progress = updateCluster(mockSvc, makeModel(), model, state)
+	assert.Equal(t, handler.InProgress, progress.OperationStatus)
+	assert.Equal(t, "1.16", *mockSvc.ClusterVersionInput.Version)
+	state = stateOf(t, progress)
+	assert.Equal(t, phaseWaitingUpdate, state.Phase)
+	assert.Equal(t, 1, state.VersionHop)
+
+	progress = updateCluster(mockSvc, makeModel(), model, state)
+	assert.Equal(t, handler.Success, progress.OperationStatus)
+	progress = reconcileNodeGroups(mockSvc, makeModel(), model, nil)
+	assert.Equal(t, handler.InProgress, progress.OperationStatus)
+	assert.Equal(t, "1.16", *mockSvc.VersionInput.Version)
+}
@@ -0,0 +1,150 @@
+package resource
+
+import (
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"net"
+	"net/url"
+	"time"
+)
+
+const (
+	oidcClientID = "sts.amazonaws.com"
+	// oidcProviderTag is the cluster tag that records the ARN of the OIDC
+	// provider the resource created. A provider without it belongs to
+	// someone else and is never deleted.
+	oidcProviderTag = "cloudformation-eks-cluster:oidc-provider"
+	// issuerDialTimeout bounds the connection to the issuer host so an
+	// unreachable issuer fails the handler instead of outliving it.
+	issuerDialTimeout = 5 * time.Second
+)
+
+// createOidcProvider creates the IAM OIDC identity provider used for IAM roles
+// for service accounts, unless the provider the resource created earlier
+// still exists. The cluster must be ACTIVE so that its issuer URL is known.
+// A provider for the issuer that someone else created is not taken over.
+func createOidcProvider(svc iamiface.IAMAPI, eksSvc eksiface.EKSAPI, model *Model, thumbprint func(string) (string, error)) handler.ProgressEvent {
+	if model.OpenIdConnectIssuerUrl == nil {
+		return errorEvent(model, errors.New("cluster has no OpenID Connect issuer"))
+	}
+	if model.OidcProviderArn != nil {
+		_, err := svc.GetOpenIDConnectProvider(&iam.GetOpenIDConnectProviderInput{OpenIDConnectProviderArn: model.OidcProviderArn})
+		if err == nil {
+			return successEvent(model)
+		}
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != iam.ErrCodeNoSuchEntityException {
+			return errorEvent(model, err)
+		}
+	}
+	fingerprint, err := thumbprint(*model.OpenIdConnectIssuerUrl)
+	if err != nil {
+		return errorEvent(model, err)
+	}
+	input := &iam.CreateOpenIDConnectProviderInput{
+		Url:            model.OpenIdConnectIssuerUrl,
+		ClientIDList:   []*string{aws.String(oidcClientID)},
+		ThumbprintList: []*string{aws.String(fingerprint)},
+	}
+	response, err := svc.CreateOpenIDConnectProvider(input)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			if aerr.Code() == iam.ErrCodeEntityAlreadyExistsException {
+				return errorEvent(model, &handlerError{
+					code: cloudformation.HandlerErrorCodeAlreadyExists,
+					message: "an OIDC provider for " + *model.OpenIdConnectIssuerUrl + " already exists and is not managed by this resource; " +
+						"delete it or set EnableOidcProvider to false",
+				})
+			}
+		}
+		return errorEvent(model, err)
+	}
+	_, err = eksSvc.TagResource(&eks.TagResourceInput{
+		ResourceArn: model.Arn,
+		Tags:        map[string]*string{oidcProviderTag: response.OpenIDConnectProviderArn},
+	})
+	if err != nil {
+		// Without the tag the provider would never be deleted.
+		svc.DeleteOpenIDConnectProvider(&iam.DeleteOpenIDConnectProviderInput{OpenIDConnectProviderArn: response.OpenIDConnectProviderArn})
+		return errorEvent(model, err)
+	}
+	model.OidcProviderArn = response.OpenIDConnectProviderArn
+	return successEvent(model)
+}
+
+// deleteOidcProvider deletes the OIDC provider the resource created, if any.
+func deleteOidcProvider(svc iamiface.IAMAPI, model *Model) handler.ProgressEvent {
+	if model.OidcProviderArn == nil {
+		return successEvent(model)
+	}
+	_, err := svc.DeleteOpenIDConnectProvider(&iam.DeleteOpenIDConnectProviderInput{OpenIDConnectProviderArn: model.OidcProviderArn})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			if aerr.Code() == iam.ErrCodeNoSuchEntityException {
+				return successEvent(model)
+			}
+		}
+		return errorEvent(model, err)
+	}
+	return successEvent(model)
+}
+
+// reconcileOidcProvider creates the OIDC provider after an update when
+// EnableOidcProvider is on and the resource's provider does not exist, and
+// deletes the resource's provider when EnableOidcProvider is off. The model
+// must have been described, so that it carries the provider the cluster is
+// tagged with.
+func reconcileOidcProvider(svc iamiface.IAMAPI, eksSvc eksiface.EKSAPI, model *Model) handler.ProgressEvent {
+	if aws.BoolValue(model.EnableOidcProvider) {
+		return createOidcProvider(svc, eksSvc, model, issuerThumbprint)
+	}
+	if model.OidcProviderArn == nil {
+		return successEvent(model)
+	}
+	if progress := deleteOidcProvider(svc, model); progress.OperationStatus != handler.Success {
+		return progress
+	}
+	_, err := eksSvc.UntagResource(&eks.UntagResourceInput{ResourceArn: model.Arn, TagKeys: []*string{aws.String(oidcProviderTag)}})
+	if err != nil {
+		return errorEvent(model, err)
+	}
+	model.OidcProviderArn = nil
+	return successEvent(model)
+}
+
+// issuerThumbprint returns the SHA-1 thumbprint IAM expects for the issuer,
+// which is that of the top certificate in the chain served by the issuer host.
+func issuerThumbprint(issuerURL string) (string, error) {
+	u, err := url.Parse(issuerURL)
+	if err != nil {
+		return "", err
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: issuerDialTimeout}, "tcp", net.JoinHostPort(u.Hostname(), port), &tls.Config{ServerName: u.Hostname()})
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return chainThumbprint(conn.ConnectionState().PeerCertificates)
+}
+
+func chainThumbprint(certs []*x509.Certificate) (string, error) {
+	if len(certs) == 0 {
+		return "", errors.New("issuer did not present a certificate chain")
+	}
+	sum := sha1.Sum(certs[len(certs)-1].Raw)
+	return hex.EncodeToString(sum[:]), nil
+}
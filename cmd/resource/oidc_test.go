@@ -0,0 +1,217 @@
+package resource
+
+import (
+	"crypto/x509"
+	"errors"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type mockIAMClient struct {
+	iamiface.IAMAPI
+	MockCreateError error
+	MockDeleteError error
+	MockGetError    error
+	CreateInput     *iam.CreateOpenIDConnectProviderInput
+	DeleteInput     *iam.DeleteOpenIDConnectProviderInput
+	MockRole        *iam.Role
+	MockPolicies    []*iam.AttachedPolicy
+}
+
+func (m *mockIAMClient) GetRole(input *iam.GetRoleInput) (*iam.GetRoleOutput, error) {
+	if m.MockRole == nil {
+		return nil, awserr.New(iam.ErrCodeNoSuchEntityException, "mock aws error", anErr)
+	}
+	return &iam.GetRoleOutput{Role: m.MockRole}, nil
+}
+
+func (m *mockIAMClient) ListAttachedRolePoliciesPages(input *iam.ListAttachedRolePoliciesInput, fn func(*iam.ListAttachedRolePoliciesOutput, bool) bool) error {
+	fn(&iam.ListAttachedRolePoliciesOutput{AttachedPolicies: m.MockPolicies}, true)
+	return nil
+}
+
+func (m *mockIAMClient) CreateOpenIDConnectProvider(input *iam.CreateOpenIDConnectProviderInput) (*iam.CreateOpenIDConnectProviderOutput, error) {
+	m.CreateInput = input
+	return &iam.CreateOpenIDConnectProviderOutput{
+		OpenIDConnectProviderArn: aws.String("ProviderArn"),
+	}, m.MockCreateError
+}
+
+func (m *mockIAMClient) GetOpenIDConnectProvider(input *iam.GetOpenIDConnectProviderInput) (*iam.GetOpenIDConnectProviderOutput, error) {
+	return &iam.GetOpenIDConnectProviderOutput{}, m.MockGetError
+}
+
+func (m *mockIAMClient) DeleteOpenIDConnectProvider(input *iam.DeleteOpenIDConnectProviderInput) (*iam.DeleteOpenIDConnectProviderOutput, error) {
+	m.DeleteInput = input
+	return &iam.DeleteOpenIDConnectProviderOutput{}, m.MockDeleteError
+}
+
+func mockThumbprint(_ string) (string, error) {
+	return "thumbprint", nil
+}
+
+func makeOidcModel() *Model {
+	model := makeModel()
+	model.EnableOidcProvider = aws.Bool(true)
+	model.Arn = aws.String("arn:aws:eks:us-west-2:111122223333:cluster/test")
+	model.OpenIdConnectIssuerUrl = aws.String("https://oidc.eks.us-west-2.amazonaws.com/id/EXAMPLE")
+	return model
+}
+
+const testProviderArn = "arn:aws:iam::111122223333:oidc-provider/oidc.eks.us-west-2.amazonaws.com/id/EXAMPLE"
+
+func TestCreateOidcProvider(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		mockSvc := &mockIAMClient{}
+		eksSvc := &mockEKSClient{}
+		model := makeOidcModel()
+		progress := createOidcProvider(mockSvc, eksSvc, model, mockThumbprint)
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+		assert.Equal(t, "ProviderArn", *model.OidcProviderArn)
+		assert.Equal(t, *model.OpenIdConnectIssuerUrl, *mockSvc.CreateInput.Url)
+		assert.Equal(t, []string{"thumbprint"}, aws.StringValueSlice(mockSvc.CreateInput.ThumbprintList))
+		assert.Equal(t, []string{oidcClientID}, aws.StringValueSlice(mockSvc.CreateInput.ClientIDList))
+		assert.Equal(t, model.Arn, eksSvc.TagInput.ResourceArn)
+		assert.Equal(t, "ProviderArn", *eksSvc.TagInput.Tags[oidcProviderTag])
+	})
+	t.Run("already created", func(t *testing.T) {
+		mockSvc := &mockIAMClient{}
+		model := makeOidcModel()
+		model.OidcProviderArn = aws.String(testProviderArn)
+		progress := createOidcProvider(mockSvc, &mockEKSClient{}, model, func(_ string) (string, error) {
+			t.Fatal("thumbprint fetched for an existing provider")
+			return "", nil
+		})
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+		assert.Nil(t, mockSvc.CreateInput)
+	})
+	t.Run("created provider missing", func(t *testing.T) {
+		mockSvc := &mockIAMClient{MockGetError: awserr.New(iam.ErrCodeNoSuchEntityException, "mock aws error", anErr)}
+		model := makeOidcModel()
+		model.OidcProviderArn = aws.String(testProviderArn)
+		progress := createOidcProvider(mockSvc, &mockEKSClient{}, model, mockThumbprint)
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+		assert.NotNil(t, mockSvc.CreateInput)
+	})
+	t.Run("owned by someone else", func(t *testing.T) {
+		mockSvc := &mockIAMClient{MockCreateError: awserr.New(iam.ErrCodeEntityAlreadyExistsException, "mock aws error", anErr)}
+		eksSvc := &mockEKSClient{}
+		model := makeOidcModel()
+		progress := createOidcProvider(mockSvc, eksSvc, model, mockThumbprint)
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
+		assert.Equal(t, cloudformation.HandlerErrorCodeAlreadyExists, progress.HandlerErrorCode)
+		assert.Nil(t, model.OidcProviderArn)
+		assert.Nil(t, eksSvc.TagInput)
+	})
+	t.Run("tag error", func(t *testing.T) {
+		mockSvc := &mockIAMClient{}
+		progress := createOidcProvider(mockSvc, &mockEKSClient{MockTagError: makeAwsError(eks.ErrCodeClientException)}, makeOidcModel(), mockThumbprint)
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
+		assert.Equal(t, "ProviderArn", *mockSvc.DeleteInput.OpenIDConnectProviderArn)
+	})
+	t.Run("aws api error", func(t *testing.T) {
+		mockSvc := &mockIAMClient{MockCreateError: awserr.New(iam.ErrCodeLimitExceededException, "mock aws error", anErr)}
+		progress := createOidcProvider(mockSvc, &mockEKSClient{}, makeOidcModel(), mockThumbprint)
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
+	})
+	t.Run("thumbprint error", func(t *testing.T) {
+		progress := createOidcProvider(&mockIAMClient{}, &mockEKSClient{}, makeOidcModel(), func(_ string) (string, error) { return "", anErr })
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
+	})
+	t.Run("no issuer", func(t *testing.T) {
+		progress := createOidcProvider(&mockIAMClient{}, &mockEKSClient{}, makeModel(), mockThumbprint)
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
+	})
+}
+
+func TestDeleteOidcProvider(t *testing.T) {
+	mockSvc := &mockIAMClient{}
+	model := makeOidcModel()
+	model.OidcProviderArn = aws.String(testProviderArn)
+	t.Run("not created by the resource", func(t *testing.T) {
+		progress := deleteOidcProvider(mockSvc, makeOidcModel())
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+		assert.Nil(t, mockSvc.DeleteInput)
+	})
+	t.Run("success", func(t *testing.T) {
+		progress := deleteOidcProvider(mockSvc, model)
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+		assert.Equal(t, testProviderArn, *mockSvc.DeleteInput.OpenIDConnectProviderArn)
+	})
+	t.Run("already deleted", func(t *testing.T) {
+		mockSvc.MockDeleteError = awserr.New(iam.ErrCodeNoSuchEntityException, "mock aws error", anErr)
+		progress := deleteOidcProvider(mockSvc, model)
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+	})
+	t.Run("aws api error", func(t *testing.T) {
+		mockSvc.MockDeleteError = awserr.New(iam.ErrCodeServiceFailureException, "mock aws error", anErr)
+		progress := deleteOidcProvider(mockSvc, model)
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
+	})
+}
+
+func TestReconcileOidcProvider(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		mockSvc := &mockIAMClient{}
+		progress := reconcileOidcProvider(mockSvc, &mockEKSClient{}, makeModel())
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+		assert.Nil(t, mockSvc.CreateInput)
+		assert.Nil(t, mockSvc.DeleteInput)
+	})
+	t.Run("unchanged", func(t *testing.T) {
+		mockSvc := &mockIAMClient{}
+		model := makeOidcModel()
+		model.OidcProviderArn = aws.String(testProviderArn)
+		progress := reconcileOidcProvider(mockSvc, &mockEKSClient{}, model)
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+		assert.Nil(t, mockSvc.CreateInput)
+	})
+	t.Run("switched off", func(t *testing.T) {
+		mockSvc := &mockIAMClient{}
+		eksSvc := &mockEKSClient{}
+		model := makeOidcModel()
+		model.EnableOidcProvider = aws.Bool(false)
+		model.OidcProviderArn = aws.String(testProviderArn)
+		progress := reconcileOidcProvider(mockSvc, eksSvc, model)
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+		assert.Equal(t, testProviderArn, *mockSvc.DeleteInput.OpenIDConnectProviderArn)
+		assert.Equal(t, []string{oidcProviderTag}, aws.StringValueSlice(eksSvc.UntagInput.TagKeys))
+		assert.Nil(t, model.OidcProviderArn)
+	})
+	t.Run("switched off with a foreign provider", func(t *testing.T) {
+		mockSvc := &mockIAMClient{}
+		model := makeOidcModel()
+		model.EnableOidcProvider = aws.Bool(false)
+		progress := reconcileOidcProvider(mockSvc, &mockEKSClient{}, model)
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+		assert.Nil(t, mockSvc.DeleteInput)
+	})
+}
+
+func TestDescribeClusterToModelOidcProviderArn(t *testing.T) {
+	cluster := makeCluster()
+	cluster.Tags = aws.StringMap(map[string]string{"team": "platform", oidcProviderTag: testProviderArn})
+	model := &Model{EnableOidcProvider: aws.Bool(true)}
+	describeClusterToModel(*cluster, model)
+	assert.Equal(t, testProviderArn, *model.OidcProviderArn)
+	assert.Equal(t, []Tag{{Key: aws.String("team"), Value: aws.String("platform")}}, model.Tags)
+	delete(cluster.Tags, oidcProviderTag)
+	describeClusterToModel(*cluster, model)
+	assert.Nil(t, model.OidcProviderArn)
+}
+
+func TestChainThumbprint(t *testing.T) {
+	certs := []*x509.Certificate{{Raw: []byte("leaf")}, {Raw: []byte("abc")}}
+	thumbprint, err := chainThumbprint(certs)
+	assert.NoError(t, err)
+	assert.Equal(t, "a9993e364706816aba3e25717850c26c9cd0d89d", thumbprint)
+	_, err = chainThumbprint(nil)
+	assert.Equal(t, errors.New("issuer did not present a certificate chain"), err)
+}
@@ -0,0 +1,218 @@
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	eksServicePrincipal = "eks.amazonaws.com"
+	clusterPolicyName   = "AmazonEKSClusterPolicy"
+	// minClusterZones is the number of Availability Zones EKS requires the
+	// cluster's subnets to span.
+	minClusterZones = 2
+)
+
+// preflightCluster checks the model against the account before a cluster is
+// created, so that inputs EKS would reject, or only fail on after the
+// cluster has spent its time stabilizing, are reported straight away. Every
+// problem found is returned in a single InvalidRequest event.
+func preflightCluster(ec2Svc ec2iface.EC2API, iamSvc iamiface.IAMAPI, model *Model) handler.ProgressEvent {
+	problems := validateModel(model)
+	if model.Version != nil {
+		if err := checkSupportedVersion(*model.Version); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if model.ResourcesVpcConfig != nil {
+		vpcProblems, err := preflightVpc(ec2Svc, model.ResourcesVpcConfig)
+		if err != nil {
+			return errorEvent(model, err)
+		}
+		problems = append(problems, vpcProblems...)
+	}
+	roleProblems, err := preflightRole(iamSvc, aws.StringValue(model.RoleArn))
+	if err != nil {
+		return errorEvent(model, err)
+	}
+	problems = append(problems, roleProblems...)
+	if len(problems) > 0 {
+		return invalidRequestEvent(model, strings.Join(problems, "; "))
+	}
+	return successEvent(model)
+}
+
+// preflightVpc checks that the subnets exist, belong to one VPC and span
+// enough Availability Zones, and that the security groups are in that VPC.
+func preflightVpc(svc ec2iface.EC2API, vpcConfig *ResourcesVpcConfig) ([]string, error) {
+	problems := []string{}
+	vpcs := map[string]bool{}
+	subnets, err := svc.DescribeSubnets(&ec2.DescribeSubnetsInput{SubnetIds: aws.StringSlice(vpcConfig.SubnetIds)})
+	if err != nil {
+		if !invalidEC2Reference(err) {
+			return nil, err
+		}
+		problems = append(problems, "SubnetIds: "+err.(awserr.Error).Message())
+	} else {
+		zones := map[string]bool{}
+		for _, subnet := range subnets.Subnets {
+			zones[aws.StringValue(subnet.AvailabilityZone)] = true
+			vpcs[aws.StringValue(subnet.VpcId)] = true
+		}
+		if len(zones) < minClusterZones {
+			problems = append(problems, fmt.Sprintf("SubnetIds must span at least %d Availability Zones", minClusterZones))
+		}
+		if len(vpcs) > 1 {
+			problems = append(problems, "SubnetIds must all belong to the same VPC, not "+strings.Join(sortedKeys(vpcs), ", "))
+		}
+	}
+	if len(vpcConfig.SecurityGroupIds) == 0 {
+		return problems, nil
+	}
+	groups, err := svc.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{GroupIds: aws.StringSlice(vpcConfig.SecurityGroupIds)})
+	if err != nil {
+		if !invalidEC2Reference(err) {
+			return nil, err
+		}
+		return append(problems, "SecurityGroupIds: "+err.(awserr.Error).Message()), nil
+	}
+	if len(vpcs) == 1 {
+		for _, group := range groups.SecurityGroups {
+			if !vpcs[aws.StringValue(group.VpcId)] {
+				problems = append(problems, fmt.Sprintf("security group %s is in %s, not the subnets' VPC", aws.StringValue(group.GroupId), aws.StringValue(group.VpcId)))
+			}
+		}
+	}
+	return problems, nil
+}
+
+// invalidEC2Reference reports whether EC2 rejected a request because an ID
+// it was given is malformed or does not exist, such as
+// InvalidSubnetID.NotFound.
+func invalidEC2Reference(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && (strings.HasSuffix(aerr.Code(), ".NotFound") || strings.HasSuffix(aerr.Code(), ".Malformed"))
+}
+
+// preflightRole checks that the cluster role exists, can be assumed by EKS
+// and has the cluster policy attached.
+func preflightRole(svc iamiface.IAMAPI, roleArn string) ([]string, error) {
+	index := strings.Index(roleArn, ":role/")
+	if index < 0 {
+		return []string{fmt.Sprintf("RoleArn %q is not an IAM role ARN", roleArn)}, nil
+	}
+	path := strings.Split(roleArn[index+len(":role/"):], "/")
+	roleName := path[len(path)-1]
+	role, err := svc.GetRole(&iam.GetRoleInput{RoleName: aws.String(roleName)})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == iam.ErrCodeNoSuchEntityException {
+			return []string{fmt.Sprintf("role %s does not exist", roleName)}, nil
+		}
+		return nil, err
+	}
+	problems := []string{}
+	trusted, err := trustsService(aws.StringValue(role.Role.AssumeRolePolicyDocument), eksServicePrincipal)
+	if err != nil {
+		return nil, err
+	}
+	if !trusted {
+		problems = append(problems, fmt.Sprintf("role %s does not allow %s to assume it", roleName, eksServicePrincipal))
+	}
+	attached := false
+	err = svc.ListAttachedRolePoliciesPages(&iam.ListAttachedRolePoliciesInput{RoleName: aws.String(roleName)},
+		func(page *iam.ListAttachedRolePoliciesOutput, _ bool) bool {
+			for _, policy := range page.AttachedPolicies {
+				if strings.HasSuffix(aws.StringValue(policy.PolicyArn), ":policy/"+clusterPolicyName) {
+					attached = true
+				}
+			}
+			return !attached
+		})
+	if err != nil {
+		return nil, err
+	}
+	if !attached {
+		problems = append(problems, fmt.Sprintf("role %s does not have the %s managed policy attached", roleName, clusterPolicyName))
+	}
+	return problems, nil
+}
+
+// policyStatement is the part of an IAM policy statement needed to tell who
+// may assume a role. Fields that IAM accepts as either a string or a list
+// are decoded loosely.
+type policyStatement struct {
+	Effect    string
+	Action    interface{}
+	Principal interface{}
+}
+
+// trustsService reports whether a role trust policy, as returned URL encoded
+// by GetRole, allows service to assume the role.
+func trustsService(document string, service string) (bool, error) {
+	decoded, err := url.QueryUnescape(document)
+	if err != nil {
+		return false, err
+	}
+	var policy struct {
+		Statement json.RawMessage
+	}
+	if err := json.Unmarshal([]byte(decoded), &policy); err != nil {
+		return false, err
+	}
+	statements := []policyStatement{}
+	if err := json.Unmarshal(policy.Statement, &statements); err != nil {
+		statement := policyStatement{}
+		if err := json.Unmarshal(policy.Statement, &statement); err != nil {
+			return false, err
+		}
+		statements = append(statements, statement)
+	}
+	for _, statement := range statements {
+		if statement.Effect != "Allow" || !containsString(looseStrings(statement.Action), "sts:AssumeRole") {
+			continue
+		}
+		if principal, ok := statement.Principal.(map[string]interface{}); ok {
+			if containsString(looseStrings(principal["Service"]), service) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// looseStrings reads a policy value that may be a single string or a list
+// of strings.
+func looseStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := []string{}
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,124 @@
+package resource
+
+import (
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+)
+
+const eksTrustPolicy = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"eks.amazonaws.com"},"Action":"sts:AssumeRole"}]}`
+
+type mockEC2Client struct {
+	ec2iface.EC2API
+	MockSubnets        []*ec2.Subnet
+	MockSecurityGroups []*ec2.SecurityGroup
+	MockSubnetsError   error
+	MockGroupsError    error
+}
+
+func (m *mockEC2Client) DescribeSubnets(input *ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error) {
+	return &ec2.DescribeSubnetsOutput{Subnets: m.MockSubnets}, m.MockSubnetsError
+}
+
+func (m *mockEC2Client) DescribeSecurityGroups(input *ec2.DescribeSecurityGroupsInput) (*ec2.DescribeSecurityGroupsOutput, error) {
+	return &ec2.DescribeSecurityGroupsOutput{SecurityGroups: m.MockSecurityGroups}, m.MockGroupsError
+}
+
+func makeEC2Client() *mockEC2Client {
+	return &mockEC2Client{
+		MockSubnets: []*ec2.Subnet{
+			{SubnetId: aws.String("subnet-1"), VpcId: aws.String("vpc-1"), AvailabilityZone: aws.String("us-west-2a")},
+			{SubnetId: aws.String("subnet-2"), VpcId: aws.String("vpc-1"), AvailabilityZone: aws.String("us-west-2b")},
+		},
+		MockSecurityGroups: []*ec2.SecurityGroup{{GroupId: aws.String("sg-1"), VpcId: aws.String("vpc-1")}},
+	}
+}
+
+func makeClusterRoleClient() *mockIAMClient {
+	return &mockIAMClient{
+		MockRole: &iam.Role{
+			RoleName:                 aws.String("cluster"),
+			AssumeRolePolicyDocument: aws.String(url.QueryEscape(eksTrustPolicy)),
+		},
+		MockPolicies: []*iam.AttachedPolicy{{PolicyArn: aws.String("arn:aws:iam::aws:policy/AmazonEKSClusterPolicy")}},
+	}
+}
+
+func makePreflightModel() *Model {
+	model := makeModel()
+	model.RoleArn = aws.String("arn:aws:iam::111122223333:role/service/cluster")
+	model.ResourcesVpcConfig.SubnetIds = []string{"subnet-1", "subnet-2"}
+	return model
+}
+
+func TestPreflightCluster(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		progress := preflightCluster(makeEC2Client(), makeClusterRoleClient(), makePreflightModel())
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+	})
+	t.Run("every problem", func(t *testing.T) {
+		ec2Svc := makeEC2Client()
+		ec2Svc.MockSubnets[1].AvailabilityZone = aws.String("us-west-2a")
+		ec2Svc.MockSecurityGroups[0].VpcId = aws.String("vpc-2")
+		iamSvc := makeClusterRoleClient()
+		iamSvc.MockRole.AssumeRolePolicyDocument = aws.String(url.QueryEscape(`{"Statement":{"Effect":"Allow","Principal":{"Service":["ec2.amazonaws.com"]},"Action":["sts:AssumeRole"]}}`))
+		iamSvc.MockPolicies = nil
+		model := makePreflightModel()
+		model.Version = aws.String("1.9")
+		progress := preflightCluster(ec2Svc, iamSvc, model)
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
+		assert.Equal(t, cloudformation.HandlerErrorCodeInvalidRequest, progress.HandlerErrorCode)
+		assert.Contains(t, progress.Message, "Version 1.9 is not supported")
+		assert.Contains(t, progress.Message, "at least 2 Availability Zones")
+		assert.Contains(t, progress.Message, "security group sg-1 is in vpc-2")
+		assert.Contains(t, progress.Message, "does not allow eks.amazonaws.com")
+		assert.Contains(t, progress.Message, "AmazonEKSClusterPolicy")
+	})
+	t.Run("malformed version", func(t *testing.T) {
+		model := makePreflightModel()
+		model.Version = aws.String("latest")
+		progress := preflightCluster(makeEC2Client(), makeClusterRoleClient(), model)
+		assert.Equal(t, handler.Failed, progress.OperationStatus)
+		assert.Contains(t, progress.Message, `invalid Kubernetes version "latest"`)
+	})
+	t.Run("newer version left to EKS", func(t *testing.T) {
+		model := makePreflightModel()
+		model.Version = aws.String("1.30")
+		progress := preflightCluster(makeEC2Client(), makeClusterRoleClient(), model)
+		assert.Equal(t, handler.Success, progress.OperationStatus)
+	})
+	t.Run("subnets in several vpcs", func(t *testing.T) {
+		ec2Svc := makeEC2Client()
+		ec2Svc.MockSubnets[1].VpcId = aws.String("vpc-2")
+		progress := preflightCluster(ec2Svc, makeClusterRoleClient(), makePreflightModel())
+		assert.Equal(t, "SubnetIds must all belong to the same VPC, not vpc-1, vpc-2", progress.Message)
+	})
+	t.Run("missing resources", func(t *testing.T) {
+		ec2Svc := makeEC2Client()
+		ec2Svc.MockSubnetsError = awserr.New("InvalidSubnetID.NotFound", "The subnet ID 'subnet-2' does not exist", anErr)
+		ec2Svc.MockGroupsError = awserr.New("InvalidGroup.NotFound", "The security group 'sg-1' does not exist", anErr)
+		progress := preflightCluster(ec2Svc, &mockIAMClient{}, makePreflightModel())
+		assert.Equal(t, cloudformation.HandlerErrorCodeInvalidRequest, progress.HandlerErrorCode)
+		assert.Equal(t, "SubnetIds: The subnet ID 'subnet-2' does not exist; "+
+			"SecurityGroupIds: The security group 'sg-1' does not exist; role cluster does not exist", progress.Message)
+	})
+	t.Run("not a role arn", func(t *testing.T) {
+		model := makePreflightModel()
+		model.RoleArn = aws.String("role")
+		progress := preflightCluster(makeEC2Client(), makeClusterRoleClient(), model)
+		assert.Equal(t, "RoleArn \"role\" is not an IAM role ARN", progress.Message)
+	})
+	t.Run("service error", func(t *testing.T) {
+		ec2Svc := makeEC2Client()
+		ec2Svc.MockSubnetsError = awserr.New("UnauthorizedOperation", "mock aws error", anErr)
+		progress := preflightCluster(ec2Svc, makeClusterRoleClient(), makePreflightModel())
+		assert.Equal(t, cloudformation.HandlerErrorCodeAccessDenied, progress.HandlerErrorCode)
+	})
+}
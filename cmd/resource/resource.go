@@ -2,25 +2,139 @@ package resource
 
 import (
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"time"
 )
 
 func Create(req handler.Request, _ *Model, model *Model) (handler.ProgressEvent, error) {
-	return createCluster(eks.New(req.Session), model, req.CallbackContext), nil
+	state, err := callbackStateFromContext(req.CallbackContext, phaseCreating)
+	if err != nil {
+		return invalidContextEvent(model, err), nil
+	}
+	state.restoreClusterName(model)
+	return finishProgress(createResource(req, model, state), state), nil
+}
+
+func createResource(req handler.Request, model *Model, state *callbackState) handler.ProgressEvent {
+	deadline := time.Now().Add(manifestBudget)
+	svc := newRetryingEKS(eks.New(req.Session))
+	if state == nil {
+		if progress := preflightCluster(ec2.New(req.Session), iam.New(req.Session), model); progress.OperationStatus != handler.Success {
+			return progress
+		}
+	}
+	progress := createCluster(svc, model, state)
+	if progress.OperationStatus == handler.Success {
+		progress = reconcileNodeGroups(svc, nil, model, state)
+	}
+	if progress.OperationStatus == handler.Success {
+		progress = reconcileFargateProfiles(svc, nil, model)
+	}
+	if progress.OperationStatus == handler.Success {
+		progress = reconcileAuthMappings(svc, nil, model, kubernetesConnector(sts.New(req.Session)))
+	}
+	if progress.OperationStatus == handler.Success {
+		progress = reconcileManifests(svc, s3.New(req.Session), nil, model, state, kubernetesConnector(sts.New(req.Session)), deadline)
+	}
+	if progress.OperationStatus == handler.Success && aws.BoolValue(model.EnableOidcProvider) {
+		return createOidcProvider(iam.New(req.Session), svc, model, issuerThumbprint)
+	}
+	return progress
 }
 
 func Read(req handler.Request, _ *Model, model *Model) (handler.ProgressEvent, error) {
-	return describeCluster(eks.New(req.Session), model), nil
+	return describeCluster(newRetryingEKS(eks.New(req.Session)), model), nil
+}
+
+func Update(req handler.Request, prevModel *Model, model *Model) (handler.ProgressEvent, error) {
+	state, err := callbackStateFromContext(req.CallbackContext, phaseUpdating)
+	if err != nil {
+		return invalidContextEvent(model, err), nil
+	}
+	state.restoreClusterName(model)
+	return finishProgress(updateResource(req, prevModel, model, state), state), nil
 }
 
-func Update(req handler.Request, _ *Model, model *Model) (handler.ProgressEvent, error) {
-	return updateCluster(eks.New(req.Session), model, req.CallbackContext), nil
+func updateResource(req handler.Request, prevModel *Model, model *Model, state *callbackState) handler.ProgressEvent {
+	deadline := time.Now().Add(manifestBudget)
+	svc := newRetryingEKS(eks.New(req.Session))
+	progress := updateCluster(svc, prevModel, model, state)
+	if progress.OperationStatus == handler.Success {
+		progress = reconcileNodeGroups(svc, prevModel, model, state)
+	}
+	if progress.OperationStatus == handler.Success {
+		progress = reconcileFargateProfiles(svc, prevModel, model)
+	}
+	if progress.OperationStatus == handler.Success {
+		progress = reconcileAuthMappings(svc, prevModel, model, kubernetesConnector(sts.New(req.Session)))
+	}
+	if progress.OperationStatus == handler.Success {
+		progress = reconcileManifests(svc, s3.New(req.Session), prevModel, model, state, kubernetesConnector(sts.New(req.Session)), deadline)
+	}
+	if progress.OperationStatus == handler.Success {
+		return reconcileOidcProvider(iam.New(req.Session), svc, model)
+	}
+	return progress
 }
 
 func Delete(req handler.Request, _ *Model, model *Model) (handler.ProgressEvent, error) {
-	return deleteCluster(eks.New(req.Session), model, req.CallbackContext), nil
+	state, err := callbackStateFromContext(req.CallbackContext, phaseDeleting)
+	if err != nil {
+		return invalidContextEvent(model, err), nil
+	}
+	state.restoreClusterName(model)
+	return finishProgress(deleteResource(req, model, state), state), nil
+}
+
+// deleteResource removes the OIDC provider, then the objects in the
+// cluster's manifests, then its node groups and Fargate profiles, and
+// finally the cluster. While deleting, the manifest, node group and Fargate
+// profile phases mean dependents are still being removed.
+func deleteResource(req handler.Request, model *Model, state *callbackState) handler.ProgressEvent {
+	deadline := time.Now().Add(manifestBudget)
+	svc := newRetryingEKS(eks.New(req.Session))
+	if state == nil {
+		// Nothing is deleted if the cluster cannot be.
+		if progress := checkDependents(svc, model); progress.OperationStatus != handler.Success {
+			return progress
+		}
+	}
+	if state == nil && aws.BoolValue(model.EnableOidcProvider) {
+		if progress := describeCluster(svc, model); progress.OperationStatus != handler.Success {
+			return progress
+		}
+		if progress := deleteOidcProvider(iam.New(req.Session), model); progress.OperationStatus != handler.Success {
+			return progress
+		}
+	}
+	if state == nil || state.Phase == phaseManifests {
+		progress := deleteManifests(svc, s3.New(req.Session), model, state, kubernetesConnector(sts.New(req.Session)), deadline)
+		if progress.OperationStatus != handler.Success {
+			return progress
+		}
+	}
+	if state == nil || state.Phase == phaseManifests || state.Phase == phaseNodeGroups || state.Phase == phaseFargateProfiles {
+		if progress := deleteDependents(svc, model); progress.OperationStatus != handler.Success {
+			return progress
+		}
+		return deleteCluster(svc, model, nil)
+	}
+	return deleteCluster(svc, model, state)
 }
 
 func List(req handler.Request, _ *Model, _ *Model) (handler.ProgressEvent, error) {
-	return listClusters(eks.New(req.Session)), nil
+	return listAllClusters(newRetryingEKS(eks.New(req.Session))), nil
+}
+
+// finishProgress reschedules failures that may clear up on their own and
+// stamps the start times of the operation and its phase.
+func finishProgress(progress handler.ProgressEvent, state *callbackState) handler.ProgressEvent {
+	progress = retryLaterEvent(progress, state.context())
+	stampCallbackContext(progress.CallbackContext, state, time.Now())
+	return progress
 }
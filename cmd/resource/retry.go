@@ -0,0 +1,289 @@
+package resource
+
+import (
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	"math/rand"
+	"time"
+)
+
+const (
+	// retryBudget is how long a single invocation spends retrying calls,
+	// leaving headroom within the plugin's 60 second handler timeout.
+	retryBudget    = 40 * time.Second
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 10 * time.Second
+)
+
+// retryingEKS retries the EKS calls made by the handlers when they fail with
+// throttling or, for calls that are safe to repeat, a transient service or
+// network error, backing off exponentially with full jitter. Retries stop
+// once the invocation's retry budget would be exceeded and the last error is
+// returned, so the handler can reschedule itself rather than fail.
+type retryingEKS struct {
+	eksiface.EKSAPI
+	deadline time.Time
+	sleep    func(time.Duration)
+}
+
+func newRetryingEKS(svc eksiface.EKSAPI) eksiface.EKSAPI {
+	return &retryingEKS{
+		EKSAPI:   svc,
+		deadline: time.Now().Add(retryBudget),
+		sleep:    time.Sleep,
+	}
+}
+
+func (c *retryingEKS) retry(call func() error) error {
+	return c.retryOn(call, retryableError)
+}
+
+// retryThrottled retries a call that changes something only when it was
+// throttled. A call that failed with a service or network error may have
+// taken effect, so repeating it could start a second operation. The handler
+// reschedules itself instead; createCluster, for one, records the cluster's
+// name beforehand so that the next invocation finds a cluster the failed call
+// created.
+func (c *retryingEKS) retryThrottled(call func() error) error {
+	return c.retryOn(call, func(err error) bool {
+		return handlerErrorCode(err) == cloudformation.HandlerErrorCodeThrottling
+	})
+}
+
+func (c *retryingEKS) retryOn(call func() error, retryable func(error) bool) error {
+	for attempt := 0; ; attempt++ {
+		err := call()
+		if err == nil || !retryable(err) {
+			return err
+		}
+		delay := backoffDelay(attempt)
+		if time.Now().Add(delay).After(c.deadline) {
+			return err
+		}
+		c.sleep(delay)
+	}
+}
+
+// retryableError reports whether a call that failed with err may succeed if
+// it is repeated.
+func retryableError(err error) bool {
+	return retryableErrorCode(handlerErrorCode(err))
+}
+
+func retryableErrorCode(code string) bool {
+	switch code {
+	case cloudformation.HandlerErrorCodeThrottling,
+		cloudformation.HandlerErrorCodeServiceInternalError,
+		cloudformation.HandlerErrorCodeNetworkFailure:
+		return true
+	}
+	return false
+}
+
+// backoffDelay picks a random delay of up to retryBaseDelay doubled for each
+// previous attempt, capped at retryMaxDelay.
+func backoffDelay(attempt int) time.Duration {
+	ceiling := retryMaxDelay
+	if attempt < 16 && retryBaseDelay<<uint(attempt) < ceiling {
+		ceiling = retryBaseDelay << uint(attempt)
+	}
+	return time.Duration(rand.Int63n(int64(ceiling))) + 1
+}
+
+func (c *retryingEKS) CreateCluster(input *eks.CreateClusterInput) (*eks.CreateClusterOutput, error) {
+	var output *eks.CreateClusterOutput
+	err := c.retryThrottled(func() (err error) {
+		output, err = c.EKSAPI.CreateCluster(input)
+		return err
+	})
+	return output, err
+}
+
+func (c *retryingEKS) DescribeCluster(input *eks.DescribeClusterInput) (*eks.DescribeClusterOutput, error) {
+	var output *eks.DescribeClusterOutput
+	err := c.retry(func() (err error) {
+		output, err = c.EKSAPI.DescribeCluster(input)
+		return err
+	})
+	return output, err
+}
+
+func (c *retryingEKS) UpdateClusterConfig(input *eks.UpdateClusterConfigInput) (*eks.UpdateClusterConfigOutput, error) {
+	var output *eks.UpdateClusterConfigOutput
+	err := c.retryThrottled(func() (err error) {
+		output, err = c.EKSAPI.UpdateClusterConfig(input)
+		return err
+	})
+	return output, err
+}
+
+func (c *retryingEKS) UpdateClusterVersion(input *eks.UpdateClusterVersionInput) (*eks.UpdateClusterVersionOutput, error) {
+	var output *eks.UpdateClusterVersionOutput
+	err := c.retryThrottled(func() (err error) {
+		output, err = c.EKSAPI.UpdateClusterVersion(input)
+		return err
+	})
+	return output, err
+}
+
+func (c *retryingEKS) DescribeUpdate(input *eks.DescribeUpdateInput) (*eks.DescribeUpdateOutput, error) {
+	var output *eks.DescribeUpdateOutput
+	err := c.retry(func() (err error) {
+		output, err = c.EKSAPI.DescribeUpdate(input)
+		return err
+	})
+	return output, err
+}
+
+func (c *retryingEKS) TagResource(input *eks.TagResourceInput) (*eks.TagResourceOutput, error) {
+	var output *eks.TagResourceOutput
+	err := c.retry(func() (err error) {
+		output, err = c.EKSAPI.TagResource(input)
+		return err
+	})
+	return output, err
+}
+
+func (c *retryingEKS) UntagResource(input *eks.UntagResourceInput) (*eks.UntagResourceOutput, error) {
+	var output *eks.UntagResourceOutput
+	err := c.retry(func() (err error) {
+		output, err = c.EKSAPI.UntagResource(input)
+		return err
+	})
+	return output, err
+}
+
+func (c *retryingEKS) DeleteCluster(input *eks.DeleteClusterInput) (*eks.DeleteClusterOutput, error) {
+	var output *eks.DeleteClusterOutput
+	err := c.retryThrottled(func() (err error) {
+		output, err = c.EKSAPI.DeleteCluster(input)
+		return err
+	})
+	return output, err
+}
+
+func (c *retryingEKS) ListClusters(input *eks.ListClustersInput) (*eks.ListClustersOutput, error) {
+	var output *eks.ListClustersOutput
+	err := c.retry(func() (err error) {
+		output, err = c.EKSAPI.ListClusters(input)
+		return err
+	})
+	return output, err
+}
+
+func (c *retryingEKS) CreateNodegroup(input *eks.CreateNodegroupInput) (*eks.CreateNodegroupOutput, error) {
+	var output *eks.CreateNodegroupOutput
+	err := c.retryThrottled(func() (err error) {
+		output, err = c.EKSAPI.CreateNodegroup(input)
+		return err
+	})
+	return output, err
+}
+
+func (c *retryingEKS) DescribeNodegroup(input *eks.DescribeNodegroupInput) (*eks.DescribeNodegroupOutput, error) {
+	var output *eks.DescribeNodegroupOutput
+	err := c.retry(func() (err error) {
+		output, err = c.EKSAPI.DescribeNodegroup(input)
+		return err
+	})
+	return output, err
+}
+
+func (c *retryingEKS) UpdateNodegroupConfig(input *eks.UpdateNodegroupConfigInput) (*eks.UpdateNodegroupConfigOutput, error) {
+	var output *eks.UpdateNodegroupConfigOutput
+	err := c.retryThrottled(func() (err error) {
+		output, err = c.EKSAPI.UpdateNodegroupConfig(input)
+		return err
+	})
+	return output, err
+}
+
+func (c *retryingEKS) UpdateNodegroupVersion(input *eks.UpdateNodegroupVersionInput) (*eks.UpdateNodegroupVersionOutput, error) {
+	var output *eks.UpdateNodegroupVersionOutput
+	err := c.retryThrottled(func() (err error) {
+		output, err = c.EKSAPI.UpdateNodegroupVersion(input)
+		return err
+	})
+	return output, err
+}
+
+func (c *retryingEKS) DeleteNodegroup(input *eks.DeleteNodegroupInput) (*eks.DeleteNodegroupOutput, error) {
+	var output *eks.DeleteNodegroupOutput
+	err := c.retryThrottled(func() (err error) {
+		output, err = c.EKSAPI.DeleteNodegroup(input)
+		return err
+	})
+	return output, err
+}
+
+func (c *retryingEKS) CreateFargateProfile(input *eks.CreateFargateProfileInput) (*eks.CreateFargateProfileOutput, error) {
+	var output *eks.CreateFargateProfileOutput
+	err := c.retryThrottled(func() (err error) {
+		output, err = c.EKSAPI.CreateFargateProfile(input)
+		return err
+	})
+	return output, err
+}
+
+func (c *retryingEKS) DescribeFargateProfile(input *eks.DescribeFargateProfileInput) (*eks.DescribeFargateProfileOutput, error) {
+	var output *eks.DescribeFargateProfileOutput
+	err := c.retry(func() (err error) {
+		output, err = c.EKSAPI.DescribeFargateProfile(input)
+		return err
+	})
+	return output, err
+}
+
+func (c *retryingEKS) DeleteFargateProfile(input *eks.DeleteFargateProfileInput) (*eks.DeleteFargateProfileOutput, error) {
+	var output *eks.DeleteFargateProfileOutput
+	err := c.retryThrottled(func() (err error) {
+		output, err = c.EKSAPI.DeleteFargateProfile(input)
+		return err
+	})
+	return output, err
+}
+
+// ListNodegroupsPages collects every page before passing them to fn, so a retry
+// part way through does not repeat pages.
+func (c *retryingEKS) ListNodegroupsPages(input *eks.ListNodegroupsInput, fn func(*eks.ListNodegroupsOutput, bool) bool) error {
+	var pages []*eks.ListNodegroupsOutput
+	err := c.retry(func() error {
+		pages = nil
+		return c.EKSAPI.ListNodegroupsPages(input, func(page *eks.ListNodegroupsOutput, _ bool) bool {
+			pages = append(pages, page)
+			return true
+		})
+	})
+	if err != nil {
+		return err
+	}
+	for i, page := range pages {
+		if !fn(page, i == len(pages)-1) {
+			break
+		}
+	}
+	return nil
+}
+
+// ListFargateProfilesPages collects every page before passing them to fn, so a retry
+// part way through does not repeat pages.
+func (c *retryingEKS) ListFargateProfilesPages(input *eks.ListFargateProfilesInput, fn func(*eks.ListFargateProfilesOutput, bool) bool) error {
+	var pages []*eks.ListFargateProfilesOutput
+	err := c.retry(func() error {
+		pages = nil
+		return c.EKSAPI.ListFargateProfilesPages(input, func(page *eks.ListFargateProfilesOutput, _ bool) bool {
+			pages = append(pages, page)
+			return true
+		})
+	})
+	if err != nil {
+		return err
+	}
+	for i, page := range pages {
+		if !fn(page, i == len(pages)-1) {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package resource
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type mockFlakyClient struct {
+	eksiface.EKSAPI
+	Errors []error
+	Calls  int
+}
+
+func (m *mockFlakyClient) nextError() error {
+	m.Calls++
+	if len(m.Errors) == 0 {
+		return nil
+	}
+	err := m.Errors[0]
+	m.Errors = m.Errors[1:]
+	return err
+}
+
+func (m *mockFlakyClient) DescribeCluster(input *eks.DescribeClusterInput) (*eks.DescribeClusterOutput, error) {
+	if err := m.nextError(); err != nil {
+		return nil, err
+	}
+	return &eks.DescribeClusterOutput{Cluster: &eks.Cluster{Name: input.Name}}, nil
+}
+
+func (m *mockFlakyClient) CreateCluster(input *eks.CreateClusterInput) (*eks.CreateClusterOutput, error) {
+	if err := m.nextError(); err != nil {
+		return nil, err
+	}
+	return &eks.CreateClusterOutput{Cluster: &eks.Cluster{Name: input.Name}}, nil
+}
+
+func (m *mockFlakyClient) ListNodegroupsPages(_ *eks.ListNodegroupsInput, fn func(*eks.ListNodegroupsOutput, bool) bool) error {
+	fn(&eks.ListNodegroupsOutput{Nodegroups: aws.StringSlice([]string{"a"})}, false)
+	if err := m.nextError(); err != nil {
+		return err
+	}
+	fn(&eks.ListNodegroupsOutput{Nodegroups: aws.StringSlice([]string{"b"})}, true)
+	return nil
+}
+
+func makeRetryingClient(svc eksiface.EKSAPI, budget time.Duration) (*retryingEKS, *[]time.Duration) {
+	delays := []time.Duration{}
+	return &retryingEKS{
+		EKSAPI:   svc,
+		deadline: time.Now().Add(budget),
+		sleep:    func(d time.Duration) { delays = append(delays, d) },
+	}, &delays
+}
+
+func TestRetryingEKS(t *testing.T) {
+	t.Run("retries throttling", func(t *testing.T) {
+		mockSvc := &mockFlakyClient{Errors: []error{
+			makeAwsError("ThrottlingException"),
+			makeAwsError(eks.ErrCodeServiceUnavailableException),
+		}}
+		svc, delays := makeRetryingClient(mockSvc, time.Minute)
+		response, err := svc.DescribeCluster(&eks.DescribeClusterInput{Name: aws.String("test")})
+		assert.Nil(t, err)
+		assert.Equal(t, aws.String("test"), response.Cluster.Name)
+		assert.Equal(t, 3, mockSvc.Calls)
+		assert.Len(t, *delays, 2)
+	})
+	t.Run("does not retry other errors", func(t *testing.T) {
+		mockSvc := &mockFlakyClient{Errors: []error{makeAwsError(eks.ErrCodeInvalidParameterException)}}
+		svc, _ := makeRetryingClient(mockSvc, time.Minute)
+		_, err := svc.DescribeCluster(&eks.DescribeClusterInput{Name: aws.String("test")})
+		assert.NotNil(t, err)
+		assert.Equal(t, 1, mockSvc.Calls)
+	})
+	t.Run("retries throttled mutating calls", func(t *testing.T) {
+		mockSvc := &mockFlakyClient{Errors: []error{makeAwsError("ThrottlingException")}}
+		svc, _ := makeRetryingClient(mockSvc, time.Minute)
+		_, err := svc.CreateCluster(&eks.CreateClusterInput{Name: aws.String("test")})
+		assert.Nil(t, err)
+		assert.Equal(t, 2, mockSvc.Calls)
+	})
+	t.Run("does not repeat mutating calls after service errors", func(t *testing.T) {
+		mockSvc := &mockFlakyClient{Errors: []error{makeAwsError(eks.ErrCodeServiceUnavailableException)}}
+		svc, delays := makeRetryingClient(mockSvc, time.Minute)
+		_, err := svc.CreateCluster(&eks.CreateClusterInput{Name: aws.String("test")})
+		assert.Equal(t, cloudformation.HandlerErrorCodeServiceInternalError, handlerErrorCode(err))
+		assert.Equal(t, 1, mockSvc.Calls)
+		assert.Empty(t, *delays)
+	})
+	t.Run("budget exhausted", func(t *testing.T) {
+		mockSvc := &mockFlakyClient{Errors: []error{makeAwsError("ThrottlingException")}}
+		svc, delays := makeRetryingClient(mockSvc, 0)
+		_, err := svc.DescribeCluster(&eks.DescribeClusterInput{Name: aws.String("test")})
+		assert.Equal(t, cloudformation.HandlerErrorCodeThrottling, handlerErrorCode(err))
+		assert.Equal(t, 1, mockSvc.Calls)
+		assert.Empty(t, *delays)
+	})
+	t.Run("pages are not repeated", func(t *testing.T) {
+		mockSvc := &mockFlakyClient{Errors: []error{makeAwsError("ThrottlingException")}}
+		svc, _ := makeRetryingClient(mockSvc, time.Minute)
+		names := []string{}
+		err := svc.ListNodegroupsPages(&eks.ListNodegroupsInput{}, func(page *eks.ListNodegroupsOutput, _ bool) bool {
+			names = append(names, aws.StringValueSlice(page.Nodegroups)...)
+			return true
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"a", "b"}, names)
+	})
+}
+
+func TestBackoffDelay(t *testing.T) {
+	for attempt := 0; attempt < 100; attempt++ {
+		delay := backoffDelay(attempt)
+		assert.True(t, delay > 0)
+		assert.True(t, delay <= retryMaxDelay)
+	}
+	assert.True(t, backoffDelay(0) <= retryBaseDelay)
+}
@@ -0,0 +1,194 @@
+package resource
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"net"
+	"regexp"
+	"strings"
+)
+
+var accountIDPattern = regexp.MustCompile(`^[0-9]{12}$`)
+
+// validateModel checks the model for property combinations that EKS would
+// reject, so they can be reported before any API call is made. It returns a
+// description of every problem found.
+func validateModel(model *Model) []string {
+	problems := []string{}
+	if vpcConfig := model.ResourcesVpcConfig; vpcConfig != nil {
+		publicAccess := vpcConfig.EndpointPublicAccess == nil || *vpcConfig.EndpointPublicAccess
+		privateAccess := aws.BoolValue(vpcConfig.EndpointPrivateAccess)
+		if !publicAccess && !privateAccess {
+			problems = append(problems, "EndpointPublicAccess and EndpointPrivateAccess cannot both be disabled")
+		}
+		if !publicAccess && len(vpcConfig.PublicAccessCidrs) > 0 {
+			problems = append(problems, "PublicAccessCidrs cannot be set when EndpointPublicAccess is disabled")
+		}
+		for _, cidr := range vpcConfig.PublicAccessCidrs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				problems = append(problems, fmt.Sprintf("PublicAccessCidrs contains an invalid CIDR block %q", cidr))
+			}
+		}
+	}
+	if model.Logging != nil {
+		for _, logType := range model.Logging.EnabledTypes {
+			if !containsString(logTypes, logType) {
+				problems = append(problems, fmt.Sprintf("Logging contains an unsupported log type %q", logType))
+			}
+		}
+	}
+	keys := map[string]bool{}
+	for _, tag := range model.Tags {
+		key := aws.StringValue(tag.Key)
+		switch {
+		case key == "":
+			problems = append(problems, "Tags contains a tag without a Key")
+		case strings.HasPrefix(strings.ToLower(key), "aws:"):
+			problems = append(problems, fmt.Sprintf("Tags key %q uses the reserved aws: prefix", key))
+		case key == oidcProviderTag:
+			problems = append(problems, fmt.Sprintf("Tags key %q is reserved for the resource", key))
+		case keys[key]:
+			problems = append(problems, fmt.Sprintf("Tags contains the key %q more than once", key))
+		}
+		keys[key] = true
+	}
+	names := map[string]bool{}
+	for _, nodeGroup := range model.NodeGroups {
+		name := aws.StringValue(nodeGroup.Name)
+		switch {
+		case name == "":
+			problems = append(problems, "NodeGroups contains a node group without a Name")
+		case names[name]:
+			problems = append(problems, fmt.Sprintf("NodeGroups contains the name %q more than once", name))
+		}
+		names[name] = true
+		if nodeGroup.NodeRole == nil {
+			problems = append(problems, fmt.Sprintf("node group %q has no NodeRole", name))
+		}
+		if scaling := nodeGroup.ScalingConfig; scaling != nil {
+			if scaling.MinSize != nil && scaling.MaxSize != nil && *scaling.MinSize > *scaling.MaxSize {
+				problems = append(problems, fmt.Sprintf("node group %q MinSize is greater than MaxSize", name))
+			}
+			if scaling.DesiredSize != nil {
+				if (scaling.MinSize != nil && *scaling.DesiredSize < *scaling.MinSize) ||
+					(scaling.MaxSize != nil && *scaling.DesiredSize > *scaling.MaxSize) {
+					problems = append(problems, fmt.Sprintf("node group %q DesiredSize must be between MinSize and MaxSize", name))
+				}
+			}
+		}
+	}
+	if policy := model.DependencyDeletionPolicy; policy != nil && *policy != deletionPolicyFail && *policy != deletionPolicyCascade {
+		problems = append(problems, fmt.Sprintf("DependencyDeletionPolicy must be %s or %s", deletionPolicyFail, deletionPolicyCascade))
+	}
+	profiles := map[string]bool{}
+	for _, profile := range model.FargateProfiles {
+		name := aws.StringValue(profile.Name)
+		switch {
+		case name == "":
+			problems = append(problems, "FargateProfiles contains a profile without a Name")
+		case profiles[name]:
+			problems = append(problems, fmt.Sprintf("FargateProfiles contains the name %q more than once", name))
+		}
+		profiles[name] = true
+		if profile.PodExecutionRoleArn == nil {
+			problems = append(problems, fmt.Sprintf("Fargate profile %q has no PodExecutionRoleArn", name))
+		}
+		if len(profile.Selectors) == 0 || len(profile.Selectors) > 5 {
+			problems = append(problems, fmt.Sprintf("Fargate profile %q must have between 1 and 5 Selectors", name))
+		}
+		for _, selector := range profile.Selectors {
+			if aws.StringValue(selector.Namespace) == "" {
+				problems = append(problems, fmt.Sprintf("Fargate profile %q has a selector without a Namespace", name))
+			}
+		}
+	}
+	problems = append(problems, validateAuthMappings(model)...)
+	problems = append(problems, validateManifests(model)...)
+	return problems
+}
+
+// validateAuthMappings checks the entries the resource adds to the aws-auth
+// config map.
+func validateAuthMappings(model *Model) []string {
+	problems := []string{}
+	if authMappingsConfigured(model) && !endpointAccessOf(model.ResourcesVpcConfig).Public {
+		problems = append(problems, kubernetesEndpointProblem("MapRoles, MapUsers and MapAccounts"))
+	}
+	roles := map[string]bool{}
+	for _, mapping := range model.MapRoles {
+		arn := aws.StringValue(mapping.RoleArn)
+		switch {
+		case arn == "":
+			problems = append(problems, "MapRoles contains a mapping without a RoleArn")
+		case roles[arn]:
+			problems = append(problems, fmt.Sprintf("MapRoles contains the role %q more than once", arn))
+		}
+		roles[arn] = true
+		if aws.StringValue(mapping.Username) == "" {
+			problems = append(problems, fmt.Sprintf("MapRoles mapping for %q has no Username", arn))
+		}
+	}
+	users := map[string]bool{}
+	for _, mapping := range model.MapUsers {
+		arn := aws.StringValue(mapping.UserArn)
+		switch {
+		case arn == "":
+			problems = append(problems, "MapUsers contains a mapping without a UserArn")
+		case users[arn]:
+			problems = append(problems, fmt.Sprintf("MapUsers contains the user %q more than once", arn))
+		}
+		users[arn] = true
+		if aws.StringValue(mapping.Username) == "" {
+			problems = append(problems, fmt.Sprintf("MapUsers mapping for %q has no Username", arn))
+		}
+	}
+	accounts := map[string]bool{}
+	for _, account := range model.MapAccounts {
+		if !accountIDPattern.MatchString(account) {
+			problems = append(problems, fmt.Sprintf("MapAccounts contains an invalid account ID %q", account))
+		} else if accounts[account] {
+			problems = append(problems, fmt.Sprintf("MapAccounts contains the account %q more than once", account))
+		}
+		accounts[account] = true
+	}
+	return problems
+}
+
+// kubernetesEndpointProblem describes why properties applied through the
+// Kubernetes API can't be used with the cluster's endpoint access. The
+// handler reaches the API over the public endpoint, so a private-only
+// cluster would leave it retrying a connection that can never succeed.
+func kubernetesEndpointProblem(properties string) string {
+	return fmt.Sprintf("%s are applied through the Kubernetes API and require EndpointPublicAccess", properties)
+}
+
+// validateManifests checks the inline manifests and the form of the S3
+// manifest URIs. The content of S3 manifests is only checked when it is
+// loaded.
+func validateManifests(model *Model) []string {
+	problems := []string{}
+	if len(model.Manifests) > 0 && !endpointAccessOf(model.ResourcesVpcConfig).Public {
+		problems = append(problems, kubernetesEndpointProblem("Manifests"))
+	}
+	objects := map[string]bool{}
+	for i, manifest := range model.Manifests {
+		if isS3URI(manifest) {
+			if _, err := parseS3URI(manifest); err != nil {
+				problems = append(problems, err.Error())
+			}
+			continue
+		}
+		parsed, err := parseManifest(fmt.Sprintf("Manifests[%d]", i), []byte(manifest))
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		for _, object := range parsed {
+			if objects[object.key()] {
+				problems = append(problems, fmt.Sprintf("Manifests contains the object %s more than once", object.key()))
+			}
+			objects[object.key()] = true
+		}
+	}
+	return problems
+}
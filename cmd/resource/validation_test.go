@@ -0,0 +1,85 @@
+package resource
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestValidateModel(t *testing.T) {
+	cases := []struct {
+		Name                  string
+		EndpointPublicAccess  *bool
+		EndpointPrivateAccess *bool
+		PublicAccessCidrs     []string
+		Problems              int
+	}{
+		{"defaults", nil, nil, nil, 0},
+		{"private only", aws.Bool(false), aws.Bool(true), nil, 0},
+		{"public with cidrs", aws.Bool(true), aws.Bool(false), []string{"203.0.113.0/24"}, 0},
+		{"both disabled", aws.Bool(false), aws.Bool(false), nil, 1},
+		{"private defaults disabled", aws.Bool(false), nil, nil, 1},
+		{"cidrs without public access", aws.Bool(false), aws.Bool(true), []string{"203.0.113.0/24"}, 1},
+		{"invalid cidr", nil, nil, []string{"203.0.113.0"}, 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			model := makeModel()
+			model.ResourcesVpcConfig.EndpointPublicAccess = tc.EndpointPublicAccess
+			model.ResourcesVpcConfig.EndpointPrivateAccess = tc.EndpointPrivateAccess
+			model.ResourcesVpcConfig.PublicAccessCidrs = tc.PublicAccessCidrs
+			assert.Len(t, validateModel(model), tc.Problems)
+		})
+	}
+}
+
+func TestValidateModelLogging(t *testing.T) {
+	model := makeModel()
+	model.Logging = &Logging{EnabledTypes: []string{"audit", "authenticator"}}
+	assert.Empty(t, validateModel(model))
+	model.Logging.EnabledTypes = append(model.Logging.EnabledTypes, "kubelet")
+	assert.Len(t, validateModel(model), 1)
+}
+
+func TestValidateModelTags(t *testing.T) {
+	model := makeModel()
+	model.Tags = []Tag{{Key: aws.String("team"), Value: aws.String("platform")}}
+	assert.Empty(t, validateModel(model))
+	model.Tags = append(model.Tags,
+		Tag{Key: aws.String("team"), Value: aws.String("data")},
+		Tag{Key: aws.String("aws:cloudformation:stack-name"), Value: aws.String("stack")},
+		Tag{Value: aws.String("no key")},
+		Tag{Key: aws.String(oidcProviderTag), Value: aws.String("arn")},
+	)
+	assert.Len(t, validateModel(model), 4)
+}
+
+func TestValidateModelNodeGroups(t *testing.T) {
+	model := makeModel()
+	model.NodeGroups = []NodeGroup{makeNodeGroup("workers")}
+	assert.Empty(t, validateModel(model))
+	invalid := makeNodeGroup("workers")
+	invalid.NodeRole = nil
+	invalid.ScalingConfig = &ScalingConfig{MinSize: aws.Int(3), MaxSize: aws.Int(2), DesiredSize: aws.Int(1)}
+	model.NodeGroups = append(model.NodeGroups, invalid)
+	assert.Len(t, validateModel(model), 4)
+}
+
+func TestValidateModelFargateProfiles(t *testing.T) {
+	model := makeModel()
+	model.FargateProfiles = []FargateProfile{makeFargateProfile("one")}
+	assert.Empty(t, validateModel(model))
+	model.FargateProfiles = append(model.FargateProfiles, FargateProfile{
+		Name:      aws.String("one"),
+		Selectors: []FargateProfileSelector{{}},
+	})
+	assert.Len(t, validateModel(model), 3)
+}
+
+func TestValidateModelDependencyDeletionPolicy(t *testing.T) {
+	model := makeModel()
+	model.DependencyDeletionPolicy = aws.String(deletionPolicyCascade)
+	assert.Empty(t, validateModel(model))
+	model.DependencyDeletionPolicy = aws.String("Retain")
+	assert.Len(t, validateModel(model), 1)
+}
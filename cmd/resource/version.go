@@ -0,0 +1,68 @@
+package resource
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// minSupportedVersion is the oldest Kubernetes version EKS offers for new
+// clusters. The EKS API has no call to list the supported versions, and a
+// static list would reject new releases until it was updated, so only the
+// lower bound is checked here and newer versions are left to CreateCluster.
+const minSupportedVersion = "1.12"
+
+// checkSupportedVersion reports whether version is well formed and not older
+// than minSupportedVersion.
+func checkSupportedVersion(version string) error {
+	major, minor, err := parseVersion(version)
+	if err != nil {
+		return err
+	}
+	minMajor, minMinor, _ := parseVersion(minSupportedVersion)
+	if major < minMajor || (major == minMajor && minor < minMinor) {
+		return fmt.Errorf("Version %s is not supported by EKS; the oldest supported version is %s", version, minSupportedVersion)
+	}
+	return nil
+}
+
+// versionUpgradePlan returns the chain of minor versions a cluster has to be
+// upgraded through to get from current to desired, as EKS only allows
+// upgrading one minor version at a time.
+func versionUpgradePlan(current string, desired string) ([]string, error) {
+	currentMajor, currentMinor, err := parseVersion(current)
+	if err != nil {
+		return nil, err
+	}
+	desiredMajor, desiredMinor, err := parseVersion(desired)
+	if err != nil {
+		return nil, err
+	}
+	if currentMajor != desiredMajor {
+		return nil, fmt.Errorf("cannot upgrade cluster from version %s to %s across major versions", current, desired)
+	}
+	if desiredMinor < currentMinor {
+		return nil, fmt.Errorf("cannot downgrade cluster from version %s to %s", current, desired)
+	}
+	plan := []string{}
+	for minor := currentMinor + 1; minor <= desiredMinor; minor++ {
+		plan = append(plan, fmt.Sprintf("%d.%d", desiredMajor, minor))
+	}
+	return plan, nil
+}
+
+func parseVersion(version string) (int, int, error) {
+	parts := strings.Split(version, ".")
+	if len(parts) < 2 {
+		return 0, 0, fmt.Errorf("invalid Kubernetes version %q", version)
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid Kubernetes version %q", version)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid Kubernetes version %q", version)
+	}
+	return major, minor, nil
+}
@@ -0,0 +1,33 @@
+package resource
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestVersionUpgradePlan(t *testing.T) {
+	cases := []struct {
+		Name, Current, Desired string
+		Expected               []string
+		Err                    bool
+	}{
+		{"single hop", "1.14", "1.15", []string{"1.15"}, false},
+		{"multiple hops", "1.14", "1.17", []string{"1.15", "1.16", "1.17"}, false},
+		{"unchanged", "1.15", "1.15", []string{}, false},
+		{"patch versions ignored", "1.14.9", "1.15", []string{"1.15"}, false},
+		{"downgrade", "1.15", "1.14", nil, true},
+		{"major version change", "1.15", "2.0", nil, true},
+		{"invalid version", "1.15", "latest", nil, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			plan, err := versionUpgradePlan(tc.Current, tc.Desired)
+			if tc.Err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.Expected, plan)
+		})
+	}
+}